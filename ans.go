@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	sauceEOF        = 0x1a
+	sauceFontName   = "IBM VGA"
+	sauceDateLayout = "20060102"
+)
+
+// cp437High lists the characters of code page 437 from 0x80 to 0xff.
+const cp437High = "ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒáíóúñÑªº¿⌐¬½¼¡«»░▒▓│┤╡╢╖╕╣║╗╝╜╛┐└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ "
+
+var cp437Encoding = func() map[rune]byte {
+	encoding := make(map[rune]byte)
+	index := 0x80
+
+	for _, r := range cp437High {
+		encoding[r] = byte(index)
+		index++
+	}
+
+	return encoding
+}()
+
+func encodeCP437(r rune) (byte, error) {
+	if r >= 0x20 && r < 0x7f {
+		return byte(r), nil
+	}
+
+	if b, ok := cp437Encoding[r]; ok {
+		return b, nil
+	}
+
+	return 0, fmt.Errorf("character %q has no CP437 equivalent", r)
+}
+
+func sauceField(value string, length int, name string) ([]byte, error) {
+	field := bytes.Repeat([]byte{' '}, length)
+	i := 0
+
+	for _, r := range value {
+		if i >= length {
+			return nil, fmt.Errorf("%s is longer than %d characters", name, length)
+		}
+
+		b, err := encodeCP437(r)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		field[i] = b
+		i++
+	}
+
+	return field, nil
+}
+
+// ansEscape selects a 16-color foreground the way ANSI.SYS understands it,
+// with bold standing in for the bright half of the palette.
+func ansEscape(index int) string {
+	if index < 8 {
+		return fmt.Sprintf("\x1b[0;%dm", 30+index)
+	}
+
+	return fmt.Sprintf("\x1b[0;1;%dm", 30+index-8)
+}
+
+func renderANS(art Art, opts *Options) ([]byte, error) {
+	width := artWidth(art)
+
+	if width > opts.ANSWidth {
+		return nil, fmt.Errorf("the art is %d columns wide, which is more than the --ans-width of %d", width, opts.ANSWidth)
+	}
+
+	result := &bytes.Buffer{}
+	colored := colorEnabled(opts)
+	current := -1
+	ending := lineEnding(opts, "\r\n")
+
+	for y, row := range art.Cells {
+		for _, cell := range row {
+			if colored && !cell.Plain {
+				if index := nearestANSI16(displayColor(cell, opts), opts.Match); index != current {
+					result.WriteString(ansEscape(index))
+
+					current = index
+				}
+			}
+
+			b, err := encodeCP437(cell.Char)
+
+			if err != nil {
+				return nil, err
+			}
+
+			result.WriteByte(b)
+		}
+
+		// A full-width row already moves the cursor to the next line.
+		if (y+1 != len(art.Cells) || opts.FinalNewline == "true") && len(row) < opts.ANSWidth {
+			result.WriteString(ending)
+		}
+	}
+
+	if colored {
+		result.WriteString("\x1b[0m")
+	}
+
+	fileSize := result.Len()
+	date := opts.ANSDate
+
+	if len(date) < 1 {
+		date = time.Now().Format(sauceDateLayout)
+	} else if _, err := time.Parse(sauceDateLayout, date); err != nil {
+		return nil, fmt.Errorf("invalid --ans-date %s: expected YYYYMMDD", date)
+	}
+
+	title, err := sauceField(opts.ANSTitle, 35, "--ans-title")
+
+	if err != nil {
+		return nil, err
+	}
+
+	author, err := sauceField(opts.ANSAuthor, 20, "--ans-author")
+
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := sauceField(opts.ANSGroup, 20, "--ans-group")
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.WriteByte(sauceEOF)
+	result.WriteString("SAUCE00")
+	result.Write(title)
+	result.Write(author)
+	result.Write(group)
+	result.WriteString(date)
+	binary.Write(result, binary.LittleEndian, uint32(fileSize))
+	result.WriteByte(1) // DataType: character
+	result.WriteByte(1) // FileType: ANSi
+	binary.Write(result, binary.LittleEndian, []uint16{uint16(opts.ANSWidth), uint16(len(art.Cells)), 0, 0})
+	result.WriteByte(0) // Comments
+	result.WriteByte(0) // TFlags
+
+	font := make([]byte, 22)
+
+	copy(font, sauceFontName)
+	result.Write(font)
+
+	return result.Bytes(), nil
+}
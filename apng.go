@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"time"
+)
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// apngMaxPixels bounds the pixels of the frames of an animation and the
+// canvas they are drawn on, which are allocated before their data is decoded.
+const apngMaxPixels = 1 << 28
+
+type pngChunk struct {
+	Type string
+	Data []byte
+}
+
+type apngFrame struct {
+	Rect     image.Rectangle
+	Delay    time.Duration
+	Dispose  byte
+	Blend    byte
+	Data     [][]byte
+	IsHidden bool
+}
+
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, errors.New("missing png signature")
+	}
+
+	chunks := make([]pngChunk, 0)
+	offset := len(pngSignature)
+
+	for offset < len(data) {
+		if offset+8 > len(data) {
+			return nil, fmt.Errorf("truncated chunk header at offset %d", offset)
+		}
+
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		chunkType := string(data[offset+4 : offset+8])
+
+		if length < 0 || offset+12+length > len(data) {
+			return nil, fmt.Errorf("truncated %s chunk at offset %d", chunkType, offset)
+		}
+
+		chunks = append(chunks, pngChunk{Type: chunkType, Data: data[offset+8 : offset+8+length]})
+		offset += 12 + length
+
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return chunks, nil
+}
+
+func isAPNG(data []byte) bool {
+	chunks, err := readPNGChunks(data)
+
+	if err != nil {
+		return false
+	}
+
+	for _, chunk := range chunks {
+		switch chunk.Type {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+	}
+
+	return false
+}
+
+func decodeAPNG(data []byte) ([]Frame, error) {
+	chunks, err := readPNGChunks(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chunks) < 1 || chunks[0].Type != "IHDR" || len(chunks[0].Data) != 13 {
+		return nil, errors.New("missing IHDR chunk")
+	}
+
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	ihdr := chunks[0].Data
+	bounds := image.Rect(0, 0, config.Width, config.Height)
+	shared := make([]pngChunk, 0)
+	frames := make([]*apngFrame, 0)
+
+	var current *apngFrame = nil
+
+	for _, chunk := range chunks[1:] {
+		switch chunk.Type {
+		case "fcTL":
+			if len(chunk.Data) != 26 {
+				return nil, errors.New("invalid fcTL chunk")
+			}
+
+			x := int(binary.BigEndian.Uint32(chunk.Data[12:]))
+			y := int(binary.BigEndian.Uint32(chunk.Data[16:]))
+			delayNum := float64(binary.BigEndian.Uint16(chunk.Data[20:]))
+			delayDen := float64(binary.BigEndian.Uint16(chunk.Data[22:]))
+
+			if delayDen == 0 {
+				delayDen = 100
+			}
+
+			current = &apngFrame{
+				Rect:    image.Rect(x, y, x+int(binary.BigEndian.Uint32(chunk.Data[4:])), y+int(binary.BigEndian.Uint32(chunk.Data[8:]))),
+				Delay:   time.Duration(delayNum / delayDen * float64(time.Second)),
+				Dispose: chunk.Data[24],
+				Blend:   chunk.Data[25],
+			}
+
+			frames = append(frames, current)
+		case "IDAT":
+			if current == nil {
+				current = &apngFrame{Rect: bounds, IsHidden: true}
+
+				frames = append(frames, current)
+			}
+
+			current.Data = append(current.Data, chunk.Data)
+		case "fdAT":
+			if current == nil || len(chunk.Data) < 4 {
+				return nil, errors.New("unexpected fdAT chunk")
+			}
+
+			current.Data = append(current.Data, chunk.Data[4:])
+		case "acTL", "IEND":
+		default:
+			if len(frames) < 1 {
+				shared = append(shared, chunk)
+			}
+		}
+	}
+
+	visible := 0
+
+	for _, frame := range frames {
+		if !frame.IsHidden {
+			visible++
+		}
+	}
+
+	if pixels := int64(config.Width) * int64(config.Height); pixels*int64(visible+1) > apngMaxPixels {
+		return nil, fmt.Errorf("%d frames of %dx%d are too large to decode", visible, config.Width, config.Height)
+	}
+
+	result := make([]Frame, 0, visible)
+	canvas := image.NewNRGBA(bounds)
+
+	var previous *image.NRGBA = nil
+
+	for i, frame := range frames {
+		if frame.IsHidden {
+			continue
+		}
+
+		if !frame.Rect.In(bounds) || frame.Rect.Empty() {
+			return nil, fmt.Errorf("frame %d lies outside of the image", i)
+		}
+
+		img, err := decodeAPNGFrame(ihdr, shared, frame)
+
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+
+		if frame.Dispose == 2 {
+			if previous == nil {
+				previous = image.NewNRGBA(bounds)
+			}
+
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		op := draw.Src
+
+		if frame.Blend == 1 {
+			op = draw.Over
+		}
+
+		draw.Draw(canvas, frame.Rect, img, img.Bounds().Min, op)
+
+		output := image.NewNRGBA(bounds)
+
+		copy(output.Pix, canvas.Pix)
+
+		result = append(result, Frame{Image: output, Delay: frame.Delay})
+
+		switch frame.Dispose {
+		case 1:
+			draw.Draw(canvas, frame.Rect, image.Transparent, image.Point{}, draw.Src)
+		case 2:
+			copy(canvas.Pix, previous.Pix)
+		}
+	}
+
+	if len(result) < 1 {
+		return nil, errors.New("animation contains no frames")
+	}
+
+	return result, nil
+}
+
+func decodeAPNGFrame(ihdr []byte, shared []pngChunk, frame *apngFrame) (image.Image, error) {
+	header := make([]byte, len(ihdr))
+
+	copy(header, ihdr)
+	binary.BigEndian.PutUint32(header[0:], uint32(frame.Rect.Dx()))
+	binary.BigEndian.PutUint32(header[4:], uint32(frame.Rect.Dy()))
+
+	buf := &bytes.Buffer{}
+
+	buf.WriteString(pngSignature)
+	writePNGChunk(buf, "IHDR", header)
+
+	for _, chunk := range shared {
+		writePNGChunk(buf, chunk.Type, chunk.Data)
+	}
+
+	for _, data := range frame.Data {
+		writePNGChunk(buf, "IDAT", data)
+	}
+
+	writePNGChunk(buf, "IEND", nil)
+
+	return png.Decode(buf)
+}
+
+func writePNGChunk(buf *bytes.Buffer, chunkType string, data []byte) {
+	header := make([]byte, 8)
+
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], chunkType)
+
+	crc := crc32.NewIEEE()
+
+	crc.Write(header[4:])
+	crc.Write(data)
+
+	buf.Write(header)
+	buf.Write(data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
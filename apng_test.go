@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// encodeAPNG encodes the opaque images as the frames of an animation of the
+// given size, each at its offset and with its dispose operation. The frames
+// share the header, so they must all be 8-bit RGB as png.Encode writes
+// opaque images.
+func encodeAPNG(t *testing.T, width, height int, frames []image.Image, offsets []image.Point, dispose []byte) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	header := make([]byte, 13)
+
+	binary.BigEndian.PutUint32(header[0:], uint32(width))
+	binary.BigEndian.PutUint32(header[4:], uint32(height))
+	header[8], header[9] = 8, 2
+
+	buf.WriteString(pngSignature)
+	writePNGChunk(buf, "IHDR", header)
+
+	control := make([]byte, 8)
+
+	binary.BigEndian.PutUint32(control[0:], uint32(len(frames)))
+	writePNGChunk(buf, "acTL", control)
+
+	sequence := uint32(0)
+
+	for i, frame := range frames {
+		fctl := make([]byte, 26)
+
+		binary.BigEndian.PutUint32(fctl[0:], sequence)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(frame.Bounds().Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(frame.Bounds().Dy()))
+		binary.BigEndian.PutUint32(fctl[12:], uint32(offsets[i].X))
+		binary.BigEndian.PutUint32(fctl[16:], uint32(offsets[i].Y))
+		binary.BigEndian.PutUint16(fctl[20:], 1)
+		binary.BigEndian.PutUint16(fctl[22:], 10)
+		fctl[24] = dispose[i]
+		writePNGChunk(buf, "fcTL", fctl)
+		sequence++
+
+		chunks, err := readPNGChunks(encodePNG(t, frame))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, chunk := range chunks {
+			if chunk.Type != "IDAT" {
+				continue
+			}
+
+			data := make([]byte, 4, 4+len(chunk.Data))
+
+			binary.BigEndian.PutUint32(data, sequence)
+			writePNGChunk(buf, "fdAT", append(data, chunk.Data...))
+			sequence++
+		}
+	}
+
+	writePNGChunk(buf, "IEND", nil)
+
+	return buf.Bytes()
+}
+
+// solidImage returns an image of the given size filled with c.
+func solidImage(width, height int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+
+	return img
+}
+
+func TestDecodeAPNGDispose(t *testing.T) {
+	red, green, blue := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 255, 0, 255}, color.NRGBA{0, 0, 255, 255}
+
+	// The green square is disposed to the previous frame, so the blue
+	// square is drawn over the red background without it.
+	data := encodeAPNG(t, 4, 4,
+		[]image.Image{solidImage(4, 4, red), solidImage(2, 2, green), solidImage(2, 2, blue)},
+		[]image.Point{{0, 0}, {0, 0}, {2, 2}},
+		[]byte{0, 2, 0})
+	frames, err := decodeAPNG(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		frame int
+		x, y  int
+		want  color.NRGBA
+	}{
+		{0, 0, 0, red},
+		{1, 0, 0, green},
+		{1, 3, 3, red},
+		{2, 0, 0, red},
+		{2, 3, 3, blue},
+	} {
+		if c := color.NRGBAModel.Convert(frames[test.frame].Image.At(test.x, test.y)); c != test.want {
+			t.Errorf("frame %d at %d,%d is %v, want %v", test.frame, test.x, test.y, c, test.want)
+		}
+	}
+}
+
+func TestDecodeAPNGTooLarge(t *testing.T) {
+	// The header claims far more pixels than the single pixel of data holds.
+	data := encodeAPNG(t, 1<<15, 1<<15, []image.Image{solidImage(1, 1, color.NRGBA{0, 0, 0, 255})}, []image.Point{{0, 0}}, []byte{0})
+
+	if _, err := png.DecodeConfig(bytes.NewReader(data)); err != nil {
+		t.Fatalf("fixture is not a valid png header: %s", err)
+	}
+
+	if _, err := decodeAPNG(data); err == nil {
+		t.Error("decodeAPNG accepted a 32768x32768 animation")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func archiveKind(name string, header []byte) string {
+	lower := strings.ToLower(name)
+
+	switch {
+	case strings.HasSuffix(lower, ".zip") || bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") || bytes.HasPrefix(header, []byte("\x1f\x8b")):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar") || (len(header) >= 262 && string(header[257:262]) == "ustar"):
+		return "tar"
+	}
+
+	return ""
+}
+
+func detectArchive(name string) string {
+	if name == stdinName {
+		header, _ := stdin.Peek(512)
+
+		return archiveKind("", header)
+	}
+
+	if isURL(name) || strings.HasPrefix(name, dataURIPrefix) {
+		return ""
+	}
+
+	f, err := os.Open(name)
+
+	if err != nil {
+		return ""
+	}
+
+	defer f.Close()
+
+	header := make([]byte, 512)
+	n, _ := io.ReadFull(f, header)
+
+	return archiveKind(name, header[:n])
+}
+
+func matchMember(pattern, name string) bool {
+	if len(pattern) < 1 {
+		return true
+	}
+
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+
+		return ok
+	}
+
+	return false
+}
+
+// memberOutputPath turns an archive member name into a relative path that
+// cannot escape the output directory.
+func memberOutputPath(name string) string {
+	return filepath.FromSlash(strings.TrimPrefix(path.Clean("/"+name), "/"))
+}
+
+func walkArchive(name, kind string, opts *Options, fn func(member string, data []byte) error) error {
+	if kind == "zip" {
+		var r *zip.Reader
+
+		if name == stdinName {
+			data, err := ioutil.ReadAll(stdin)
+
+			if err != nil {
+				return err
+			}
+
+			if r, err = zip.NewReader(bytes.NewReader(data), int64(len(data))); err != nil {
+				return err
+			}
+		} else {
+			rc, err := zip.OpenReader(name)
+
+			if err != nil {
+				return err
+			}
+
+			defer rc.Close()
+
+			r = &rc.Reader
+		}
+
+		for _, file := range r.File {
+			if file.FileInfo().IsDir() || !matchMember(opts.Member, file.Name) {
+				continue
+			}
+
+			f, err := file.Open()
+
+			if err != nil {
+				return err
+			}
+
+			data, err := ioutil.ReadAll(f)
+
+			f.Close()
+
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", file.Name, err)
+			}
+
+			if err = fn(file.Name, data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var r io.Reader = stdin
+
+	if name != stdinName {
+		f, err := os.Open(name)
+
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		r = f
+	}
+
+	if kind == "tar.gz" {
+		gz, err := gzip.NewReader(r)
+
+		if err != nil {
+			return err
+		}
+
+		defer gz.Close()
+
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg || !matchMember(opts.Member, header.Name) {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", header.Name, err)
+		}
+
+		if err = fn(header.Name, data); err != nil {
+			return err
+		}
+	}
+}
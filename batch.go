@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type job struct {
+	Name    string
+	Output  string
+	Archive string
+}
+
+type summary struct {
+	Converted int
+	Skipped   int
+	Failed    int
+}
+
+func (s *summary) String() string {
+	return fmt.Sprintf("%d converted, %d skipped, %d failed", s.Converted, s.Skipped, s.Failed)
+}
+
+func extensionFilter(opts *Options) map[string]bool {
+	if len(opts.Ext) < 1 {
+		return nil
+	}
+
+	filter := make(map[string]bool)
+
+	for _, value := range opts.Ext {
+		for _, ext := range strings.Split(value, ",") {
+			if ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")); len(ext) > 0 {
+				filter["."+ext] = true
+			}
+		}
+	}
+
+	return filter
+}
+
+func hasImageSignature(path string) bool {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return false
+	}
+
+	defer f.Close()
+
+	header := make([]byte, 16)
+	n, _ := io.ReadFull(f, header)
+
+	return len(detectFormat(header[:n])) > 0
+}
+
+func collectDirectory(root string, opts *Options, sum *summary) ([]job, error) {
+	jobs := make([]job, 0)
+	filter := extensionFilter(opts)
+	visited := make(map[string]bool)
+
+	var walk func(dir, rel string) error
+
+	walk = func(dir, rel string) error {
+		real, err := filepath.EvalSymlinks(dir)
+
+		if err != nil {
+			return err
+		}
+
+		if visited[real] {
+			if opts.Verbose {
+				fmt.Printf("VERBOSE: Skipping '%s' which was already visited through a symlink\n", dir)
+			}
+
+			return nil
+		}
+
+		visited[real] = true
+
+		entries, err := ioutil.ReadDir(dir)
+
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			entryRel := filepath.Join(rel, entry.Name())
+			info, err := os.Stat(path)
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "asciify: %s\n", err)
+
+				sum.Skipped++
+
+				continue
+			}
+
+			if info.IsDir() {
+				if opts.Recursive {
+					if err = walk(path, entryRel); err != nil {
+						return err
+					}
+				}
+
+				continue
+			}
+
+			if filter != nil && !filter[strings.ToLower(filepath.Ext(path))] {
+				sum.Skipped++
+
+				continue
+			}
+
+			if len(opts.Raw) < 1 && !hasImageSignature(path) {
+				if opts.Verbose {
+					fmt.Printf("VERBOSE: Skipping '%s' which is not a recognized image\n", path)
+				}
+
+				sum.Skipped++
+
+				continue
+			}
+
+			jobs = append(jobs, job{Name: path, Output: entryRel})
+		}
+
+		return nil
+	}
+
+	if err := walk(root, ""); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func readFileList(path string, null bool) ([]string, error) {
+	var data []byte
+	var err error = nil
+
+	if path == stdinName {
+		data, err = ioutil.ReadAll(stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	separator := "\n"
+
+	if null {
+		separator = "\x00"
+	}
+
+	names := make([]string, 0)
+
+	for _, line := range strings.Split(string(data), separator) {
+		if !null {
+			line = strings.TrimSuffix(line, "\r")
+		}
+
+		if len(strings.TrimSpace(line)) < 1 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		names = append(names, line)
+	}
+
+	return names, nil
+}
+
+func collectJobs(args []string, opts *Options, sum *summary) ([]job, bool, error) {
+	jobs := make([]job, 0, len(args))
+	hasDirectory := false
+
+	for _, name := range args {
+		if name != stdinName && !isURL(name) && !strings.HasPrefix(name, dataURIPrefix) {
+			if info, err := os.Stat(name); err == nil && info.IsDir() {
+				dirJobs, err := collectDirectory(name, opts, sum)
+
+				if err != nil {
+					return nil, false, err
+				}
+
+				jobs = append(jobs, dirJobs...)
+				hasDirectory = true
+
+				continue
+			}
+		}
+
+		if kind := detectArchive(name); len(kind) > 0 {
+			jobs = append(jobs, job{Name: name, Archive: kind})
+			hasDirectory = true
+
+			continue
+		}
+
+		jobs = append(jobs, job{Name: name, Output: inputBaseName(name)})
+	}
+
+	return jobs, hasDirectory || len(jobs) > 1, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// quadrantGlyphs is indexed by a mask of the filled quarters, with bits for
+// the top left, top right, bottom left and bottom right in that order.
+var quadrantGlyphs = []rune(" ▘▝▀▖▌▞▛▗▚▐▜▄▙▟█")
+
+// sextantGlyph returns the character filling the sixths of a cell set in
+// mask, with bits running left to right and then top to bottom. Unicode
+// leaves the two half blocks out of the sextant range.
+func sextantGlyph(mask int) rune {
+	switch {
+	case mask == 0:
+		return ' '
+	case mask == 21:
+		return '▌'
+	case mask == 42:
+		return '▐'
+	case mask == 63:
+		return '█'
+	case mask < 21:
+		return rune(0x1fb00 + mask - 1)
+	case mask < 42:
+		return rune(0x1fb00 + mask - 2)
+	}
+
+	return rune(0x1fb00 + mask - 3)
+}
+
+func colorError(a, b color.NRGBA) int {
+	dr, dg, db := int(a.R)-int(b.R), int(a.G)-int(b.G), int(a.B)-int(b.B)
+
+	return dr*dr + dg*dg + db*db
+}
+
+// splitCell finds the split of the pixels into a foreground and background
+// group, each drawn in its mean color, that differs least from the pixels.
+// As cells hold at most six pixels every split is simply tried in turn.
+// Pixels that are not present are always left in the background.
+func splitCell(pixels []color.NRGBA, present []bool) (int, color.NRGBA, color.NRGBA) {
+	full, absent := 1<<uint(len(pixels))-1, 0
+
+	for i := range pixels {
+		if !present[i] {
+			absent |= 1 << uint(i)
+		}
+	}
+
+	best, bestError := full&^absent, -1
+	var bestFg, bestBg color.NRGBA
+
+	// Going down from the full block prefers fewer glyph edges on ties.
+	for mask := full; mask > 0; mask-- {
+		if mask&absent != 0 {
+			continue
+		}
+
+		fg, bg := make([]color.NRGBA, 0, len(pixels)), make([]color.NRGBA, 0, len(pixels))
+
+		for i, pixel := range pixels {
+			if !present[i] {
+				continue
+			}
+
+			if mask&(1<<uint(i)) != 0 {
+				fg = append(fg, pixel)
+			} else {
+				bg = append(bg, pixel)
+			}
+		}
+
+		if len(fg) < 1 {
+			continue
+		}
+
+		fgColor, bgColor := averageColor(fg), averageColor(bg)
+
+		if len(bg) < 1 {
+			bgColor = fgColor
+		}
+		total := 0
+
+		for _, pixel := range fg {
+			total += colorError(pixel, fgColor)
+		}
+
+		for _, pixel := range bg {
+			total += colorError(pixel, bgColor)
+		}
+
+		if bestError < 0 || total < bestError {
+			best, bestError, bestFg, bestBg = mask, total, fgColor, bgColor
+		}
+	}
+
+	return best, bestFg, bestBg
+}
+
+// convertBlocks packs size pixels into every character using block mosaic
+// glyphs. With a color mode each cell gets the best two-color split of its
+// pixels, otherwise the light pixels are filled.
+func convertBlocks(img image.Image, size image.Point, glyph func(int) rune, threshold float64, opts *Options) [][]Cell {
+	bounds := img.Bounds()
+	columns := (bounds.Dx() + size.X - 1) / size.X
+	rows := (bounds.Dy() + size.Y - 1) / size.Y
+	cells := make([][]Cell, rows)
+	colored := colorEnabled(opts)
+
+	for y := 0; y < rows; y++ {
+		cells[y] = make([]Cell, columns)
+
+		for x := 0; x < columns; x++ {
+			pixels := make([]color.NRGBA, size.X*size.Y)
+			present := make([]bool, size.X*size.Y)
+			lum, count := 0.0, 0
+
+			for dy := 0; dy < size.Y; dy++ {
+				for dx := 0; dx < size.X; dx++ {
+					px, py := bounds.Min.X+x*size.X+dx, bounds.Min.Y+y*size.Y+dy
+
+					if px < bounds.Max.X && py < bounds.Max.Y {
+						i := dy*size.X + dx
+
+						pixels[i] = color.NRGBAModel.Convert(img.At(px, py)).(color.NRGBA)
+						present[i] = true
+						lum += luminance(pixels[i], opts.LumaFormula)
+						count++
+					}
+				}
+			}
+
+			cell := Cell{Lum: lum / float64(count)}
+
+			if colored {
+				mask, fg, bg := splitCell(pixels, present)
+
+				cell.Char = glyph(mask)
+				cell.Color = fg
+				cell.Background = &bg
+			} else {
+				mask := 0
+				inked := make([]color.NRGBA, 0, len(pixels))
+
+				for i, pixel := range pixels {
+					if present[i] && (luminance(pixel, opts.LumaFormula) >= threshold) != opts.Invert {
+						mask |= 1 << uint(i)
+						inked = append(inked, pixel)
+					}
+				}
+
+				cell.Char = glyph(mask)
+				cell.Color = averageColor(inked)
+			}
+
+			cells[y][x] = cell
+		}
+	}
+
+	return cells
+}
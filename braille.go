@@ -0,0 +1,68 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+const brailleBlank = 0x2800
+
+// brailleDots maps the position of a pixel within a 2x4 cell, indexed by
+// row then column, to its bit in the braille codepoint.
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+func convertBraille(img image.Image, threshold float64, opts *Options) [][]Cell {
+	size := img.Bounds().Size()
+	columns, rows := (size.X+1)/2, (size.Y+3)/4
+	cells := make([][]Cell, rows)
+	bounds := img.Bounds()
+
+	for y := 0; y < rows; y++ {
+		cells[y] = make([]Cell, columns)
+
+		for x := 0; x < columns; x++ {
+			char := rune(brailleBlank)
+			pixels := make([]color.NRGBA, 0, 8)
+			inked := make([]color.NRGBA, 0, 8)
+			lum := 0.0
+
+			for dy := 0; dy < 4; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					px, py := bounds.Min.X+x*2+dx, bounds.Min.Y+y*4+dy
+
+					if px >= bounds.Max.X || py >= bounds.Max.Y {
+						continue
+					}
+
+					pixel := color.NRGBAModel.Convert(img.At(px, py)).(color.NRGBA)
+					pixelLum := luminance(pixel, opts.LumaFormula)
+
+					pixels = append(pixels, pixel)
+					lum += pixelLum
+
+					if (pixelLum >= threshold) != opts.Invert {
+						char |= brailleDots[dy][dx]
+						inked = append(inked, pixel)
+					}
+				}
+			}
+
+			if len(inked) < 1 {
+				inked = pixels
+			}
+
+			cells[y][x] = Cell{
+				Char:  char,
+				Color: averageColor(inked),
+				Lum:   lum / float64(len(pixels)),
+			}
+		}
+	}
+
+	return cells
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// calibrationSize is the pixel size glyphs are rasterized at when measuring
+// their density, large enough for thin strokes to register.
+const calibrationSize = 64
+
+type glyphDensity struct {
+	Char     rune
+	Coverage float64
+}
+
+// measureGlyphs rasterizes each character of the ramp into a cell of the same
+// size and returns the fraction of the cell it covers. Characters the font
+// has no glyph for are dropped with a warning.
+func measureGlyphs(chars []rune, path string) ([]glyphDensity, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := opentype.Parse(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: calibrationSize, DPI: 72, Hinting: font.HintingNone})
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	defer face.Close()
+
+	buffer := &sfnt.Buffer{}
+	present := make([]rune, 0, len(chars))
+	width := fixed.Int26_6(0)
+
+	for _, char := range chars {
+		index, err := parsed.GlyphIndex(buffer, char)
+
+		if err != nil || index == 0 {
+			fmt.Fprintf(os.Stderr, "asciify: warning: %s has no glyph for %q, dropping it from the character set\n", path, char)
+
+			continue
+		}
+
+		if advance, ok := face.GlyphAdvance(char); ok && advance > width {
+			width = advance
+		}
+
+		present = append(present, char)
+	}
+
+	if len(present) < 2 {
+		return nil, fmt.Errorf("%s has glyphs for fewer than 2 characters of the character set", path)
+	}
+
+	metrics := face.Metrics()
+	cell := image.Rect(0, 0, width.Ceil(), (metrics.Ascent + metrics.Descent).Ceil())
+	densities := make([]glyphDensity, 0, len(present))
+
+	for _, char := range present {
+		mask := image.NewAlpha(cell)
+		drawer := &font.Drawer{Dst: mask, Src: image.Opaque, Face: face, Dot: fixed.Point26_6{Y: metrics.Ascent}}
+
+		drawer.DrawString(string(char))
+
+		total := 0
+
+		for _, alpha := range mask.Pix {
+			total += int(alpha)
+		}
+
+		densities = append(densities, glyphDensity{Char: char, Coverage: float64(total) / float64(255*len(mask.Pix))})
+	}
+
+	return densities, nil
+}
+
+// calibrateRamp orders the ramp by the measured density of each glyph in the
+// font given by --calibrate-font and places the breakpoints halfway between
+// neighbouring densities. Glyphs as dense as one before them are dropped, and
+// --calibrate-levels thins the ramp to the glyphs closest to evenly spaced
+// densities.
+func calibrateRamp(ramp Ramp, opts *Options) (Ramp, error) {
+	densities, err := measureGlyphs(ramp.Chars, opts.CalibrateFont)
+
+	if err != nil {
+		return Ramp{}, err
+	}
+
+	sort.SliceStable(densities, func(i, j int) bool {
+		return densities[i].Coverage < densities[j].Coverage
+	})
+
+	distinct := densities[:1]
+
+	for _, density := range densities[1:] {
+		if density.Coverage > distinct[len(distinct)-1].Coverage {
+			distinct = append(distinct, density)
+		}
+	}
+
+	if len(distinct) < 2 {
+		return Ramp{}, errors.New("every glyph of the character set covers the same area")
+	}
+
+	lowest, highest := distinct[0].Coverage, distinct[len(distinct)-1].Coverage
+	levels := make([]float64, len(distinct))
+
+	for i, density := range distinct {
+		levels[i] = (density.Coverage - lowest) / (highest - lowest)
+	}
+
+	if opts.CalibrateLevels > 1 && opts.CalibrateLevels < len(distinct) {
+		kept, keptLevels := make([]glyphDensity, 0, opts.CalibrateLevels), make([]float64, 0, opts.CalibrateLevels)
+
+		for level := 0; level < opts.CalibrateLevels; level++ {
+			target := float64(level) / float64(opts.CalibrateLevels-1)
+			best := 0
+
+			for i := range levels {
+				if math.Abs(levels[i]-target) < math.Abs(levels[best]-target) {
+					best = i
+				}
+			}
+
+			if len(kept) < 1 || kept[len(kept)-1].Char != distinct[best].Char {
+				kept, keptLevels = append(kept, distinct[best]), append(keptLevels, levels[best])
+			}
+		}
+
+		distinct, levels = kept, keptLevels
+	}
+
+	calibrated := Ramp{Chars: make([]rune, len(distinct)), Bounds: make([]float64, len(distinct)), Width: ramp.Width}
+
+	for i, density := range distinct {
+		calibrated.Chars[i] = density.Char
+
+		if i+1 < len(distinct) {
+			calibrated.Bounds[i] = (levels[i] + levels[i+1]) / 2
+		}
+	}
+
+	calibrated.Bounds[len(distinct)-1] = 1
+
+	if opts.Verbose {
+		for _, density := range distinct {
+			fmt.Printf("VERBOSE: Glyph %q covers %.2f%% of its cell\n", density.Char, density.Coverage*100)
+		}
+	}
+
+	return calibrated, nil
+}
+
+// formatRamp writes a ramp in the form --charset-string accepts.
+func formatRamp(ramp Ramp) string {
+	if ramp.Bounds == nil {
+		return string(ramp.Chars)
+	}
+
+	entries := make([]string, len(ramp.Chars))
+
+	for i, char := range ramp.Chars {
+		entries[i] = string(char) + ":" + strconv.FormatFloat(ramp.Bounds[i], 'g', -1, 64)
+	}
+
+	return strings.Join(entries, ",")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// gravityOffsets gives the share of the free space that goes before the art
+// horizontally and vertically for every --gravity.
+var gravityOffsets = map[string][2]float64{
+	"top-left":     {0, 0},
+	"top":          {0.5, 0},
+	"top-right":    {1, 0},
+	"left":         {0, 0.5},
+	"center":       {0.5, 0.5},
+	"right":        {1, 0.5},
+	"bottom-left":  {0, 1},
+	"bottom":       {0.5, 1},
+	"bottom-right": {1, 1},
+}
+
+// parseCanvas reads a --canvas size of COLSxROWS.
+func parseCanvas(value string) (image.Point, error) {
+	split := strings.SplitN(value, "x", 2)
+
+	if len(split) == 2 {
+		columns, err := strconv.Atoi(split[0])
+
+		if err == nil {
+			rows, err := strconv.Atoi(split[1])
+
+			if err == nil && columns > 0 && rows > 0 {
+				return image.Point{columns, rows}, nil
+			}
+		}
+	}
+
+	return image.Point{}, fmt.Errorf("invalid --canvas size: %s (expected COLSxROWS)", value)
+}
+
+// checkCanvas validates and parses --canvas, --canvas-fill and --gravity.
+func checkCanvas(opts *Options) error {
+	if _, ok := gravityOffsets[opts.Gravity]; !ok {
+		return fmt.Errorf("invalid --gravity: %s", opts.Gravity)
+	}
+
+	if fill := []rune(opts.CanvasFill); len(fill) != 1 || runeColumns(fill[0]) != 1 {
+		return fmt.Errorf("--canvas-fill must be a single narrow character, got %q", opts.CanvasFill)
+	}
+
+	if len(opts.Canvas) < 1 {
+		return nil
+	}
+
+	if len(opts.Resize) > 0 || opts.Scale != 0 || opts.Fit || opts.Cols > 0 || opts.Rows > 0 {
+		return fmt.Errorf("--canvas cannot be combined with -r, --scale, --fit, --cols or --rows")
+	}
+
+	canvas, err := parseCanvas(opts.Canvas)
+
+	if err != nil {
+		return err
+	}
+
+	opts.CanvasSize = canvas
+
+	return nil
+}
+
+// padCells places the art on a canvas of the given columns and rows filled
+// with --canvas-fill, where --gravity puts it. The padding is marked plain so
+// that no color is written for it. Art larger than the canvas is left as it
+// is.
+func padCells(cells [][]Cell, canvas image.Point, opts *Options) [][]Cell {
+	fill := Cell{Char: []rune(opts.CanvasFill)[0], Plain: true}
+	gravity := gravityOffsets[opts.Gravity]
+	width := 0
+
+	for _, row := range cells {
+		if columns := rowColumns(row); columns > width {
+			width = columns
+		}
+	}
+
+	padding := func(count int) []Cell {
+		row := make([]Cell, 0, count)
+
+		for i := 0; i < count; i++ {
+			row = append(row, fill)
+		}
+
+		return row
+	}
+
+	left := 0
+
+	if width < canvas.X {
+		left = int(float64(canvas.X-width) * gravity[0])
+	}
+
+	padded := make([][]Cell, 0, len(cells))
+
+	for _, row := range cells {
+		line := append(padding(left), row...)
+
+		if columns := left + rowColumns(row); columns < canvas.X {
+			line = append(line, padding(canvas.X-columns)...)
+		}
+
+		padded = append(padded, line)
+	}
+
+	if free := canvas.Y - len(padded); free > 0 {
+		top := int(float64(free) * gravity[1])
+		rows := make([][]Cell, 0, canvas.Y)
+
+		for i := 0; i < top; i++ {
+			rows = append(rows, padding(canvas.X))
+		}
+
+		rows = append(rows, padded...)
+
+		for len(rows) < canvas.Y {
+			rows = append(rows, padding(canvas.X))
+		}
+
+		padded = rows
+	}
+
+	return padded
+}
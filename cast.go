@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const castHome = "\x1b[H"
+
+type castHeader struct {
+	Version   int   `json:"version"`
+	Width     int   `json:"width"`
+	Height    int   `json:"height"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+// renderCast writes an asciinema v2 recording with one output event per
+// frame. Each frame homes the cursor so that it overdraws the previous one.
+func renderCast(arts []Art, opts *Options) ([]byte, error) {
+	header := castHeader{Version: 2, Timestamp: time.Now().Unix()}
+
+	for _, art := range arts {
+		if width := artColumns(art); width > header.Width {
+			header.Width = width
+		}
+
+		if len(art.Cells) > header.Height {
+			header.Height = len(art.Cells)
+		}
+	}
+
+	result := &bytes.Buffer{}
+	encoder := json.NewEncoder(result)
+
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(header); err != nil {
+		return nil, err
+	}
+
+	var elapsed time.Duration
+
+	for i, art := range arts {
+		data := castHome + strings.Replace(string(renderText(art, opts)), "\n", "\r\n", -1)
+
+		if i == 0 {
+			data = "\x1b[2J" + data
+		}
+
+		if err := encoder.Encode([]interface{}{elapsed.Seconds(), "o", data}); err != nil {
+			return nil, err
+		}
+
+		elapsed += art.Delay
+	}
+
+	return result.Bytes(), nil
+}
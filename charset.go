@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// charsetName names the character set in verbose output and file metadata.
+func charsetName(opts *Options) string {
+	if len(opts.CharsetString) > 0 {
+		return "custom"
+	}
+
+	return opts.Charset
+}
+
+// readCharsetLines reads a UTF-8 file and splits it into lines, removing the
+// line terminators but nothing else.
+func readCharsetLines(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%s is not valid UTF-8", path)
+	}
+
+	lines := strings.Split(string(bytes.TrimSuffix(data, []byte("\n"))), "\n")
+
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	return lines, nil
+}
+
+// loadCharsetFile registers every name=ramp line of a file in
+// ChararacterSets. Blank lines are skipped.
+func loadCharsetFile(path string) error {
+	lines, err := readCharsetLines(path)
+
+	if err != nil {
+		return err
+	}
+
+	for i, line := range lines {
+		if len(line) < 1 {
+			continue
+		}
+
+		split := strings.SplitN(line, "=", 2)
+
+		if len(split) < 2 || len(split[0]) < 1 || len(split[1]) < 1 {
+			return fmt.Errorf("%s:%d: expected name=ramp", path, i+1)
+		}
+
+		if _, err := parseRamp(split[1], fmt.Sprintf("%s:%d", path, i+1)); err != nil {
+			return err
+		}
+
+		ChararacterSets[split[0]] = split[1]
+	}
+
+	return nil
+}
+
+func charsetNames() []string {
+	names := make([]string, 0, len(ChararacterSets))
+
+	for name := range ChararacterSets {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Ramp maps luminance onto characters, darkest first. Without bounds the
+// characters divide 0–1 evenly; otherwise Bounds[i] is the upper luminance
+// bound of Chars[i] and the last bound is 1. Width is the number of columns
+// each character takes.
+type Ramp struct {
+	Chars  []rune
+	Bounds []float64
+	Width  int
+}
+
+// Char returns the character for a luminance. Without bounds each of the n
+// characters gets an equal 1/n of the range, the brightest one including 1
+// itself, and luminance outside 0–1 goes to the nearest end.
+func (r Ramp) Char(lum float64) rune {
+	if r.Bounds == nil {
+		index := len(r.Chars) - 1
+
+		// Written so NaN lands in the last bucket, as with bounds.
+		if lum < 1 {
+			index = int(float64(len(r.Chars)) * math.Max(lum, 0))
+		}
+
+		return r.Chars[index]
+	}
+
+	for i, bound := range r.Bounds {
+		if lum <= bound {
+			return r.Chars[i]
+		}
+	}
+
+	return r.Chars[len(r.Chars)-1]
+}
+
+// Invert reverses the ramp, mirroring any bounds so each character keeps the
+// width of its luminance band.
+func (r Ramp) Invert() Ramp {
+	count := len(r.Chars)
+	inverted := Ramp{Chars: make([]rune, count), Width: r.Width}
+
+	for i, char := range r.Chars {
+		inverted.Chars[count-1-i] = char
+	}
+
+	if r.Bounds != nil {
+		inverted.Bounds = make([]float64, count)
+
+		for i := 0; i < count-1; i++ {
+			inverted.Bounds[i] = 1 - r.Bounds[count-2-i]
+		}
+
+		inverted.Bounds[count-1] = 1
+	}
+
+	return inverted
+}
+
+// parseBreakpoints reads a ramp of char:bound entries separated by commas,
+// such as ".:0.08,-:0.15,#:1". It reports false when value is not in that
+// form, so that it is taken as a plain ramp instead.
+func parseBreakpoints(value string) (Ramp, bool, error) {
+	runes := []rune(value)
+	ramp := Ramp{}
+
+	for i := 0; i < len(runes); {
+		if i+1 >= len(runes) || runes[i+1] != ':' {
+			return Ramp{}, false, nil
+		}
+
+		end := i + 2
+
+		for end < len(runes) && runes[end] != ',' {
+			end++
+		}
+
+		bound, err := strconv.ParseFloat(string(runes[i+2:end]), 64)
+
+		if err != nil || end+1 == len(runes) {
+			return Ramp{}, false, nil
+		}
+
+		ramp.Chars = append(ramp.Chars, runes[i])
+		ramp.Bounds = append(ramp.Bounds, bound)
+
+		i = end + 1
+	}
+
+	if len(ramp.Chars) < 1 {
+		return Ramp{}, false, nil
+	}
+
+	for i, bound := range ramp.Bounds {
+		if bound <= 0 || (i > 0 && bound <= ramp.Bounds[i-1]) {
+			return Ramp{}, true, fmt.Errorf("breakpoint %q:%g must be above 0 and above the one before it", ramp.Chars[i], bound)
+		}
+	}
+
+	if last := ramp.Bounds[len(ramp.Bounds)-1]; last != 1 {
+		return Ramp{}, true, fmt.Errorf("the last breakpoint must be 1, got %g", last)
+	}
+
+	return ramp, true, nil
+}
+
+// parseRamp reads either a plain ramp or one with breakpoints, warning about
+// repeated characters.
+func parseRamp(value, source string) (Ramp, error) {
+	ramp, ok, err := parseBreakpoints(value)
+
+	if err != nil {
+		return Ramp{}, fmt.Errorf("%s: %w", source, err)
+	}
+
+	if !ok {
+		ramp = Ramp{Chars: []rune(value)}
+	}
+
+	if ramp.Width, err = rampWidth(ramp.Chars); err != nil {
+		return Ramp{}, fmt.Errorf("%s: %w", source, err)
+	}
+
+	warnDuplicateChars(ramp.Chars, source)
+
+	return ramp, nil
+}
+
+// resolveCharset returns the ramp selected by the options, calibrated against
+// --calibrate-font and reversed when --invert-charset is given.
+func resolveCharset(opts *Options) (Ramp, error) {
+	ramp, err := lookupCharset(opts)
+
+	if err != nil {
+		return Ramp{}, err
+	}
+
+	if len(opts.CalibrateFont) > 0 {
+		if ramp, err = calibrateRamp(ramp, opts); err != nil {
+			return Ramp{}, fmt.Errorf("--calibrate-font: %w", err)
+		}
+	}
+
+	if opts.InvertCharset {
+		ramp = ramp.Invert()
+	}
+
+	if opts.SpaceBright {
+		ramp.Chars[len(ramp.Chars)-1] = ' '
+
+		if ramp.Width > 1 {
+			ramp.Chars[len(ramp.Chars)-1] = '\u3000'
+		}
+	}
+
+	if width, err := rampWidth([]rune(opts.EdgeChars)); opts.Edges && (err != nil || width != ramp.Width) {
+		return Ramp{}, fmt.Errorf("--edge-chars must be as wide as the character set, which takes %d columns per character", ramp.Width)
+	}
+
+	return ramp, nil
+}
+
+// readRampFile reads a ramp from the first line of a file.
+func readRampFile(path string) (Ramp, error) {
+	lines, err := readCharsetLines(path)
+
+	if err != nil {
+		return Ramp{}, err
+	}
+
+	if len(lines[0]) < 1 {
+		return Ramp{}, fmt.Errorf("the first line of %s is empty", path)
+	}
+
+	return parseRamp(lines[0], path)
+}
+
+func lookupCharset(opts *Options) (Ramp, error) {
+	if len(opts.CharsetFile) > 0 {
+		if err := loadCharsetFile(opts.CharsetFile); err != nil {
+			return Ramp{}, fmt.Errorf("--charset-file: %w", err)
+		}
+	}
+
+	if len(opts.CharsetString) > 0 {
+		return parseRamp(opts.CharsetString, "--charset-string")
+	}
+
+	if strings.HasPrefix(opts.Charset, "@") {
+		ramp, err := readRampFile(opts.Charset[1:])
+
+		if err != nil {
+			return Ramp{}, fmt.Errorf("--charset: %w", err)
+		}
+
+		return ramp, nil
+	}
+
+	charset, ok := ChararacterSets[opts.Charset]
+
+	if !ok {
+		return Ramp{}, fmt.Errorf("unknown character set: %s (available: %s)", opts.Charset, strings.Join(charsetNames(), ", "))
+	}
+
+	return parseRamp(charset, opts.Charset)
+}
+
+// warnDuplicateChars warns about characters repeated in a ramp, as every
+// repeat takes a luminance level that could have had a character of its own.
+func warnDuplicateChars(charset []rune, source string) {
+	seen := make(map[rune]bool)
+	warned := make(map[rune]bool)
+
+	for _, r := range charset {
+		if seen[r] && !warned[r] {
+			fmt.Fprintf(os.Stderr, "asciify: warning: %s repeats %q, which wastes a luminance level\n", source, r)
+
+			warned[r] = true
+		}
+
+		seen[r] = true
+	}
+}
+
+// runCharsets runs the charsets command, which works with character sets
+// rather than converting images. Without a subcommand it lists them.
+func runCharsets(args []string, opts *Options) error {
+	if len(args) < 1 || args[0] == "list" {
+		return listCharsets(opts)
+	}
+
+	switch args[0] {
+	case "calibrate":
+		if len(opts.CalibrateFont) < 1 {
+			return errors.New("charsets calibrate: --calibrate-font is required")
+		}
+
+		ramp, err := resolveCharset(opts)
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(formatRamp(ramp))
+
+		return nil
+	}
+
+	return fmt.Errorf("charsets: unknown command: %s (available: list, calibrate)", args[0])
+}
+
+// previewWidth is the width of the gradient strip listed with each set.
+const previewWidth = 48
+
+// listCharsets prints every registered character set, along with those given
+// by --charset @path and --charset-string, next to a left to right gradient
+// drawn with it.
+func listCharsets(opts *Options) error {
+	if len(opts.CharsetFile) > 0 {
+		if err := loadCharsetFile(opts.CharsetFile); err != nil {
+			return fmt.Errorf("--charset-file: %w", err)
+		}
+	}
+
+	names := charsetNames()
+	ramps := make([]Ramp, 0, len(names)+2)
+
+	for _, name := range names {
+		ramp, err := parseRamp(ChararacterSets[name], name)
+
+		if err != nil {
+			return err
+		}
+
+		ramps = append(ramps, ramp)
+	}
+
+	if strings.HasPrefix(opts.Charset, "@") {
+		ramp, err := readRampFile(opts.Charset[1:])
+
+		if err != nil {
+			return fmt.Errorf("--charset: %w", err)
+		}
+
+		names, ramps = append(names, opts.Charset), append(ramps, ramp)
+	}
+
+	if len(opts.CharsetString) > 0 {
+		ramp, err := parseRamp(opts.CharsetString, "--charset-string")
+
+		if err != nil {
+			return err
+		}
+
+		names, ramps = append(names, "custom"), append(ramps, ramp)
+	}
+
+	gradient := image.NewGray(image.Rect(0, 0, previewWidth, 1))
+
+	for x := 0; x < previewWidth; x++ {
+		gradient.Pix[x] = uint8(x * 255 / (previewWidth - 1))
+	}
+
+	nameWidth := 0
+
+	for _, name := range names {
+		if width := utf8.RuneCountInString(name); width > nameWidth {
+			nameWidth = width
+		}
+	}
+
+	for i, ramp := range ramps {
+		if opts.InvertCharset {
+			ramp = ramp.Invert()
+		}
+
+		preview := renderText(Art{Cells: convert(gradient, ramp, opts.LumaFormula)}, opts)
+
+		fmt.Printf("%-*s %3d  %s\n", nameWidth, names[i], len(ramp.Chars), preview)
+	}
+
+	return nil
+}
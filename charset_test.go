@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUnicodeRamp(t *testing.T) {
+	levels := []uint8{0, 80, 160, 255}
+	img := grayImage(len(levels), 1, func(x, y int) uint8 { return levels[x] })
+
+	for _, test := range []struct {
+		ramp string
+		want string
+	}{
+		{"░▒▓█", "░▒▓█"},
+		{"⠁⠃⠇⡇", "⠁⠃⠇⡇"},
+		{"·∘○●", "·∘○●"},
+	} {
+		t.Run(test.ramp, func(t *testing.T) {
+			args := []string{"-r", "4x1", "--charset-string", test.ramp}
+			art := convertImage(t, img, args...)
+
+			if rows := artRows(art); !reflect.DeepEqual(rows, []string{test.want}) {
+				t.Fatalf("rows = %q, want %q", rows, []string{test.want})
+			}
+
+			outputs, err := renderArts([]Art{art}, testOptions(t, args...))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !utf8.Valid(outputs[0]) {
+				t.Errorf("output is not valid UTF-8: %q", outputs[0])
+			}
+
+			if string(outputs[0]) != test.want {
+				t.Errorf("output = %q, want %q", outputs[0], test.want)
+			}
+		})
+	}
+}
+
+func TestRampChar(t *testing.T) {
+	const below = 1e-9
+
+	for _, test := range []struct {
+		chars string
+		lum   float64
+		want  rune
+	}{
+		{"#", 0, '#'},
+		{"#", 1, '#'},
+		{" #", 0, ' '},
+		{" #", 0.5 - below, ' '},
+		{" #", 0.5, '#'},
+		{" #", 1, '#'},
+		{" .#", 0, ' '},
+		{" .#", 1.0/3 - below, ' '},
+		{" .#", 2.0/3 - below, '.'},
+		{" .#", 1 - below, '#'},
+		{" .#", 1, '#'},
+		{" .:#", 0, ' '},
+		{" .:#", 0.25 - below, ' '},
+		{" .:#", 0.25, '.'},
+		{" .:#", 0.5 - below, '.'},
+		{" .:#", 0.75 - below, ':'},
+		{" .:#", 0.75, '#'},
+		{" .:#", 1, '#'},
+		{" .:-=+*#%@", 0, ' '},
+		{" .:-=+*#%@", 0.1 - below, ' '},
+		{" .:-=+*#%@", 0.5 - below, '='},
+		{" .:-=+*#%@", 0.9 - below, '%'},
+		{" .:-=+*#%@", 1, '@'},
+		// Luminance outside 0–1 goes to the nearest end.
+		{" .:#", -0.5, ' '},
+		{" .:#", 1.5, '#'},
+	} {
+		if char := (Ramp{Chars: []rune(test.chars), Width: 1}).Char(test.lum); char != test.want {
+			t.Errorf("Char(%g) of %q = %q, want %q", test.lum, test.chars, char, test.want)
+		}
+	}
+}
+
+func TestRampCharFairBuckets(t *testing.T) {
+	// Samples spread evenly over 0–1 must land evenly in the characters,
+	// the brightest included.
+	ramp := Ramp{Chars: []rune(" .:-=+*#%@"), Width: 1}
+	counts := map[rune]int{}
+
+	for i := 0; i <= 1000; i++ {
+		counts[ramp.Char(float64(i)/1000)]++
+	}
+
+	for _, char := range ramp.Chars {
+		if counts[char] < 100 || counts[char] > 101 {
+			t.Errorf("%q got %d of 1001 samples, want 100 or 101", char, counts[char])
+		}
+	}
+}
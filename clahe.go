@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+var claheTilesPattern = regexp.MustCompile(`^(\d+)x(\d+)$`)
+
+// parseCLAHETiles reads a --clahe-tiles value of COLSxROWS.
+func parseCLAHETiles(value string) (image.Point, error) {
+	match := claheTilesPattern.FindStringSubmatch(value)
+
+	if match == nil {
+		return image.Point{}, fmt.Errorf("invalid --clahe-tiles: %s: give COLSxROWS, as in 8x8", value)
+	}
+
+	cols, _ := strconv.Atoi(match[1])
+	rows, _ := strconv.Atoi(match[2])
+
+	if cols < 1 || rows < 1 {
+		return image.Point{}, fmt.Errorf("invalid --clahe-tiles: %s: there must be at least 1 tile each way", value)
+	}
+
+	return image.Point{cols, rows}, nil
+}
+
+// clahe equalizes every tile of the image on its own, but limits how far each
+// tile's histogram can stretch the tones to --clahe-clip times an even
+// share, and interpolates the mappings of the tiles around every pixel so no
+// seams show between them.
+func clahe(img image.Image, opts *Options) image.Image {
+	bounds := img.Bounds()
+	size := bounds.Size()
+	tiles := opts.CLAHEGrid
+
+	// Tiles smaller than a pixel would have nothing to count.
+	if tiles.X > size.X {
+		tiles.X = size.X
+	}
+
+	if tiles.Y > size.Y {
+		tiles.Y = size.Y
+	}
+
+	lums := make([]float64, size.X*size.Y)
+
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			lums[y*size.X+x] = luminance(img.At(bounds.Min.X+x, bounds.Min.Y+y), opts.LumaFormula)
+		}
+	}
+
+	mappings := make([][256]float64, tiles.X*tiles.Y)
+
+	for ty := 0; ty < tiles.Y; ty++ {
+		for tx := 0; tx < tiles.X; tx++ {
+			x0, x1 := tx*size.X/tiles.X, (tx+1)*size.X/tiles.X
+			y0, y1 := ty*size.Y/tiles.Y, (ty+1)*size.Y/tiles.Y
+			histogram := [256]float64{}
+
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					histogram[int(math.Round(lums[y*size.X+x]*255))]++
+				}
+			}
+
+			mappings[ty*tiles.X+tx] = clipEqualize(histogram, float64((x1-x0)*(y1-y0)), opts.CLAHEClip)
+		}
+	}
+
+	// The position of a pixel in tiles, measured from the centre of the first
+	// tile, clamped so the pixels outside the outer centres use the edge tiles.
+	position := func(i, length, count int) (int, int, float64) {
+		p := (float64(i)+0.5)*float64(count)/float64(length) - 0.5
+		p = math.Max(0, math.Min(float64(count-1), p))
+		first := int(p)
+		second := first + 1
+
+		if second > count-1 {
+			second = count - 1
+		}
+
+		return first, second, p - float64(first)
+	}
+
+	return remapLuminance(img, opts.LumaFormula, func(x, y int, lum float64) float64 {
+		tx0, tx1, wx := position(x, size.X, tiles.X)
+		ty0, ty1, wy := position(y, size.Y, tiles.Y)
+		bin := int(math.Round(lums[y*size.X+x] * 255))
+		top := mappings[ty0*tiles.X+tx0][bin]*(1-wx) + mappings[ty0*tiles.X+tx1][bin]*wx
+		bottom := mappings[ty1*tiles.X+tx0][bin]*(1-wx) + mappings[ty1*tiles.X+tx1][bin]*wx
+
+		return top*(1-wy) + bottom*wy
+	})
+}
+
+// clipEqualize returns the equalizing mapping of a histogram whose bins are
+// first clipped at clip times an even share of the pixels, with the clipped
+// pixels spread over every bin.
+func clipEqualize(histogram [256]float64, pixels, clip float64) [256]float64 {
+	limit := clip * pixels / 256
+	excess := 0.0
+
+	for bin, count := range histogram {
+		if count > limit {
+			excess += count - limit
+			histogram[bin] = limit
+		}
+	}
+
+	mapping := [256]float64{}
+	total := 0.0
+
+	for bin, count := range histogram {
+		total += count + excess/256
+		mapping[bin] = total / pixels
+	}
+
+	return mapping
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCLAHESmoothGradient(t *testing.T) {
+	// Neighbouring pixels of the gradient differ by at most one level. The
+	// clip limit of 2 lets a tile stretch that to about two, so anything
+	// beyond four is a seam where the mapping jumps between tiles.
+	img := grayImage(256, 256, func(x, y int) uint8 { return uint8((x + y) / 2) })
+	result := clahe(img, testOptions(t, "--clahe"))
+	limit := 4.0 / 255
+
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			lum := luminance(result.At(x, y), nil)
+
+			if x > 0 {
+				if step := math.Abs(lum - luminance(result.At(x-1, y), nil)); step > limit {
+					t.Fatalf("luminance jumps by %.4f between %d,%d and the pixel to its left", step, x, y)
+				}
+			}
+
+			if y > 0 {
+				if step := math.Abs(lum - luminance(result.At(x, y-1), nil)); step > limit {
+					t.Fatalf("luminance jumps by %.4f between %d,%d and the pixel above", step, x, y)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// sharpenSigma is the radius, in pixels of the resized image, of the blur
+// --sharpen subtracts.
+const sharpenSigma = 1.0
+
+// checkConvolve validates the options that filter the resized image.
+func checkConvolve(opts *Options) error {
+	if !(opts.Sharpen >= 0) || math.IsInf(opts.Sharpen, 0) {
+		return fmt.Errorf("--sharpen must be a number of at least 0, got %g", opts.Sharpen)
+	}
+
+	if !(opts.Blur >= 0) || math.IsInf(opts.Blur, 0) {
+		return fmt.Errorf("--blur must be a number of at least 0, got %g", opts.Blur)
+	}
+
+	if opts.Denoise < 0 {
+		return fmt.Errorf("--denoise must be at least 0, got %d", opts.Denoise)
+	}
+
+	return nil
+}
+
+// gaussianKernel returns the normalised weights of a Gaussian of the given
+// sigma, out to three sigma either side of the centre.
+func gaussianKernel(sigma float64) []float64 {
+	radius := int(math.Ceil(sigma * 3))
+	weights := make([]float64, radius*2+1)
+	total := 0.0
+
+	for i := range weights {
+		d := float64(i - radius)
+		weights[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		total += weights[i]
+	}
+
+	for i := range weights {
+		weights[i] /= total
+	}
+
+	return weights
+}
+
+// premultiplied reads the image into rows of premultiplied RGBA from 0 to 1.
+func premultiplied(img image.Image) [][]float64 {
+	bounds := img.Bounds()
+	pixels := make([][]float64, bounds.Dy())
+
+	for y := range pixels {
+		pixels[y] = make([]float64, bounds.Dx()*4)
+
+		for x := 0; x < bounds.Dx(); x++ {
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+
+			for c, v := range [4]uint32{r, g, b, a} {
+				pixels[y][x*4+c] = float64(v) / math.MaxUint16
+			}
+		}
+	}
+
+	return pixels
+}
+
+// fromPremultiplied writes rows of premultiplied RGBA back into an image,
+// clamping every color to valid values.
+func fromPremultiplied(pixels [][]float64) image.Image {
+	width := 0
+
+	if len(pixels) > 0 {
+		width = len(pixels[0]) / 4
+	}
+
+	output := image.NewRGBA64(image.Rect(0, 0, width, len(pixels)))
+
+	for y, row := range pixels {
+		for x := 0; x < width; x++ {
+			alpha := math.Max(0, math.Min(1, row[x*4+3]))
+			channel := func(v float64) uint16 { return uint16(math.Round(math.Max(0, math.Min(alpha, v)) * math.MaxUint16)) }
+
+			output.SetRGBA64(x, y, color.RGBA64{channel(row[x*4]), channel(row[x*4+1]), channel(row[x*4+2]), uint16(math.Round(alpha * math.MaxUint16))})
+		}
+	}
+
+	return output
+}
+
+// gaussianBlur blurs premultiplied pixels horizontally and then vertically,
+// repeating the pixels at the border outwards.
+func gaussianBlur(pixels [][]float64, sigma float64) [][]float64 {
+	weights := gaussianKernel(sigma)
+	radius := len(weights) / 2
+	height := len(pixels)
+
+	if height < 1 {
+		return pixels
+	}
+
+	width := len(pixels[0]) / 4
+	clamp := func(i, n int) int {
+		if i < 0 {
+			return 0
+		} else if i >= n {
+			return n - 1
+		}
+
+		return i
+	}
+
+	horizontal := make([][]float64, height)
+
+	for y, row := range pixels {
+		horizontal[y] = make([]float64, len(row))
+
+		for x := 0; x < width; x++ {
+			for i, weight := range weights {
+				sx := clamp(x+i-radius, width)
+
+				for c := 0; c < 4; c++ {
+					horizontal[y][x*4+c] += row[sx*4+c] * weight
+				}
+			}
+		}
+	}
+
+	blurred := make([][]float64, height)
+
+	for y := range blurred {
+		blurred[y] = make([]float64, width*4)
+
+		for i, weight := range weights {
+			row := horizontal[clamp(y+i-radius, height)]
+
+			for j, v := range row {
+				blurred[y][j] += v * weight
+			}
+		}
+	}
+
+	return blurred
+}
+
+// sharpen applies an unsharp mask: it adds amount times the difference
+// between the image and a blurred copy back to every channel.
+func sharpen(img image.Image, amount float64) image.Image {
+	pixels := premultiplied(img)
+	blurred := gaussianBlur(pixels, sharpenSigma)
+
+	for y, row := range pixels {
+		for i := range row {
+			row[i] += amount * (row[i] - blurred[y][i])
+		}
+	}
+
+	return fromPremultiplied(pixels)
+}
+
+// blur applies a Gaussian blur of the given sigma in pixels.
+func blur(img image.Image, sigma float64) image.Image {
+	return fromPremultiplied(gaussianBlur(premultiplied(img), sigma))
+}
+
+// denoise replaces every channel of every pixel with its median over the
+// square of pixels radius around it, which removes isolated specks without
+// blurring edges. Pixels beyond the border repeat the ones on it.
+func denoise(img image.Image, radius int) image.Image {
+	pixels := premultiplied(img)
+	height := len(pixels)
+	width := img.Bounds().Dx()
+	output := make([][]float64, height)
+	window := make([]float64, 0, (radius*2+1)*(radius*2+1))
+	clamp := func(i, n int) int {
+		if i < 0 {
+			return 0
+		} else if i >= n {
+			return n - 1
+		}
+
+		return i
+	}
+
+	for y := range output {
+		output[y] = make([]float64, width*4)
+
+		for x := 0; x < width; x++ {
+			for c := 0; c < 4; c++ {
+				window = window[:0]
+
+				for dy := -radius; dy <= radius; dy++ {
+					row := pixels[clamp(y+dy, height)]
+
+					for dx := -radius; dx <= radius; dx++ {
+						window = append(window, row[clamp(x+dx, width)*4+c])
+					}
+				}
+
+				sort.Float64s(window)
+				output[y][x*4+c] = window[len(window)/2]
+			}
+		}
+	}
+
+	return fromPremultiplied(output)
+}
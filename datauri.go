@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+const dataURIPrefix = "data:image/"
+
+func isDataURI(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(dataURIPrefix))
+}
+
+func parseDataURI(value string) (*Input, error) {
+	value = strings.TrimSpace(value)
+	comma := strings.Index(value, ",")
+
+	if !strings.HasPrefix(value, "data:") || comma < 0 {
+		return nil, fmt.Errorf("invalid data URI header: missing ',' separating the header from the payload")
+	}
+
+	header := value[len("data:"):comma]
+	payload := value[comma+1:]
+	isBase64 := strings.HasSuffix(header, ";base64")
+
+	if isBase64 {
+		header = strings.TrimSuffix(header, ";base64")
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URI header: %w", err)
+	}
+
+	var data []byte
+
+	if isBase64 {
+		payload = strings.NewReplacer("\n", "", "\r", "", " ", "", "\t", "").Replace(payload)
+
+		if data, err = base64.StdEncoding.DecodeString(payload); err != nil {
+			if data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "=")); err != nil {
+				return nil, fmt.Errorf("invalid data URI encoding: %w", err)
+			}
+		}
+	} else {
+		decoded, err := url.PathUnescape(payload)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid data URI encoding: %w", err)
+		}
+
+		data = []byte(decoded)
+	}
+
+	return &Input{Name: "data URI", Data: data, Declared: mimeFormats[mediaType]}, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+type Frame struct {
+	Image image.Image
+	Delay time.Duration
+}
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported or corrupt image")
+	imageSignatures     = []struct {
+		Format string
+		Magic  string
+	}{
+		{"png", "\x89PNG\r\n\x1a\n"},
+		{"jpeg", "\xff\xd8"},
+		{"gif", "GIF8"},
+		{"bmp", "BM"},
+		{"tiff", "II*\x00"},
+		{"tiff", "MM\x00*"},
+		{"webp", "RIFF????WEBP"},
+		{"pbm", "P1"},
+		{"pgm", "P2"},
+		{"ppm", "P3"},
+		{"pbm", "P4"},
+		{"pgm", "P5"},
+		{"ppm", "P6"},
+		{"farbfeld", farbfeldMagic},
+		{"ico", icoMagic},
+	}
+	extensionFormats = map[string]string{
+		".png":  "png",
+		".apng": "png",
+		".jpg":  "jpeg",
+		".jpeg": "jpeg",
+		".gif":  "gif",
+		".bmp":  "bmp",
+		".tif":  "tiff",
+		".tiff": "tiff",
+		".webp": "webp",
+		".pbm":  "pbm",
+		".pgm":  "pgm",
+		".ppm":  "ppm",
+		".ff":   "farbfeld",
+		".ico":  "ico",
+	}
+)
+
+func matchMagic(magic string, data []byte) bool {
+	if len(data) < len(magic) {
+		return false
+	}
+
+	for i := 0; i < len(magic); i++ {
+		if magic[i] != '?' && magic[i] != data[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func detectFormat(data []byte) string {
+	for _, sig := range imageSignatures {
+		if matchMagic(sig.Magic, data) {
+			return sig.Format
+		}
+	}
+
+	return ""
+}
+
+func extensionFormat(path string) string {
+	return extensionFormats[strings.ToLower(filepath.Ext(path))]
+}
+
+func decodeImage(data []byte) (image.Image, string, error) {
+	if detectFormat(data) == "jpeg" {
+		if info := readJPEGInfo(data); info.Components == 4 && !info.AdobeTransformValid {
+			img, err := decodeCMYKJPEG(data)
+
+			if err != nil {
+				return nil, "jpeg", fmt.Errorf("%w: detected jpeg: %s", ErrUnsupportedImage, err)
+			}
+
+			return img, "jpeg", nil
+		}
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		detected := detectFormat(data)
+
+		if len(detected) < 1 {
+			return nil, "", fmt.Errorf("%w: unrecognized format", ErrUnsupportedImage)
+		}
+
+		if errors.Is(err, image.ErrFormat) {
+			return nil, detected, fmt.Errorf("%w: detected %s, which has no decoder", ErrUnsupportedImage, detected)
+		}
+
+		return nil, detected, fmt.Errorf("%w: detected %s: %s", ErrUnsupportedImage, detected, err)
+	}
+
+	return img, format, nil
+}
+
+func decodeFrames(data []byte, opts *Options) ([]Frame, string, error) {
+	if len(opts.Raw) > 0 {
+		spec, err := parseRawSpec(opts.Raw)
+
+		if err != nil {
+			return nil, "raw", err
+		}
+
+		img, err := decodeRaw(data, spec)
+
+		if err != nil {
+			return nil, "raw", err
+		}
+
+		return []Frame{{Image: img}}, "raw", nil
+	}
+
+	if isAPNG(data) {
+		frames, err := decodeAPNG(data)
+
+		if err != nil {
+			return nil, "png", fmt.Errorf("%w: detected apng: %s", ErrUnsupportedImage, err)
+		}
+
+		return frames, "png", nil
+	}
+
+	if detectFormat(data) == "gif" {
+		frames, err := decodeGIF(data)
+
+		if err != nil {
+			return nil, "gif", fmt.Errorf("%w: detected gif: %s", ErrUnsupportedImage, err)
+		}
+
+		return frames, "gif", nil
+	}
+
+	if detectFormat(data) == "tiff" {
+		offsets, err := tiffPageOffsets(data)
+
+		if err != nil {
+			return nil, "tiff", fmt.Errorf("%w: detected tiff: %s", ErrUnsupportedImage, err)
+		}
+
+		if opts.Page < 1 || opts.Page > len(offsets) {
+			return nil, "tiff", fmt.Errorf("invalid page %d: image contains %d pages", opts.Page, len(offsets))
+		}
+
+		if opts.Verbose && len(offsets) > 1 {
+			fmt.Printf("VERBOSE: Selected page %d of %d\n", opts.Page, len(offsets))
+		}
+
+		data = selectTIFFPage(data, offsets, opts.Page)
+	}
+
+	if detectFormat(data) == "ico" {
+		entries, err := readICOEntries(data)
+
+		if err != nil {
+			return nil, "ico", fmt.Errorf("%w: detected ico: %s", ErrUnsupportedImage, err)
+		}
+
+		if opts.IcoIndex < 0 || opts.IcoIndex > len(entries) {
+			return nil, "ico", fmt.Errorf("invalid ico index %d: icon contains %d entries", opts.IcoIndex, len(entries))
+		}
+
+		img, err := decodeICO(entries, opts)
+
+		if err != nil {
+			return nil, "ico", fmt.Errorf("%w: detected ico: %s", ErrUnsupportedImage, err)
+		}
+
+		return []Frame{{Image: img}}, "ico", nil
+	}
+
+	img, format, err := decodeImage(data)
+
+	if err != nil {
+		return nil, format, err
+	}
+
+	if cmyk, ok := img.(*image.CMYK); ok {
+		img = cmykToRGBA(cmyk)
+	}
+
+	if format == "jpeg" && !opts.NoAutoOrient {
+		if orientation := readJPEGInfo(data).Orientation; orientation > 1 {
+			img = orient(img, orientation)
+
+			if opts.Verbose {
+				fmt.Printf("VERBOSE: Applied EXIF orientation %d\n", orientation)
+			}
+		}
+	}
+
+	return []Frame{{Image: img}}, format, nil
+}
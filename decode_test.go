@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/bmp"
+)
+
+func TestDecodeBMP(t *testing.T) {
+	levels := []uint8{0, 85, 170, 255}
+	opaque := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	translucent := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+
+	for y, v := range levels {
+		for x := 0; x < 4; x++ {
+			opaque.Set(x, y, color.RGBA{v, v, v, 255})
+			translucent.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+
+	// A pixel that is not quite opaque makes the encoder write 32 bits.
+	translucent.SetNRGBA(3, 3, color.NRGBA{255, 255, 255, 254})
+
+	for _, test := range []struct {
+		name string
+		img  image.Image
+		bits uint16
+	}{
+		{"24-bit", opaque, 24},
+		{"32-bit", translucent, 32},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data := &bytes.Buffer{}
+
+			if err := bmp.Encode(data, test.img); err != nil {
+				t.Fatal(err)
+			}
+
+			// The encoder writes the rows bottom-up, like most BMP files.
+			if bits := uint16(data.Bytes()[28]) | uint16(data.Bytes()[29])<<8; bits != test.bits {
+				t.Fatalf("fixture has %d bits per pixel, want %d", bits, test.bits)
+			}
+
+			if format := detectFormat(data.Bytes()); format != "bmp" {
+				t.Fatalf("detectFormat = %q, want bmp", format)
+			}
+
+			art := convertData(t, data.Bytes(), "-r", "4x4", "--charset-string", " .:#")
+			want := []string{"    ", "....", "::::", "####"}
+
+			if rows := artRows(art); !reflect.DeepEqual(rows, want) {
+				t.Errorf("rows = %q, want %q", rows, want)
+			}
+		})
+	}
+}
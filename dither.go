@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// diffusionWeight passes a share of the quantization error of a cell on to
+// the cell dx to the right and dy below.
+type diffusionWeight struct {
+	DX, DY int
+	Weight float64
+}
+
+var diffusionKernels = map[string][]diffusionWeight{
+	"floyd-steinberg": {{1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16}},
+}
+
+// bayerMatrix is the 8×8 ordered dither threshold map, holding every value
+// from 0 to 63 once.
+var bayerMatrix = [8][8]float64{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// checkDither validates the --dither options.
+func checkDither(opts *Options) error {
+	if opts.Dither == "none" {
+		return nil
+	}
+
+	if _, ok := diffusionKernels[opts.Dither]; !ok && opts.Dither != "ordered" {
+		return fmt.Errorf("invalid --dither: %s", opts.Dither)
+	}
+
+	if !(opts.DitherStrength >= 0) || math.IsInf(opts.DitherStrength, 0) {
+		return fmt.Errorf("--dither-strength must be a number of at least 0, got %g", opts.DitherStrength)
+	}
+
+	if opts.Mode != "ascii" {
+		return fmt.Errorf("--dither only works with --mode=ascii")
+	}
+
+	if len(opts.MapExpr) > 0 {
+		return fmt.Errorf("--dither cannot be combined with --map-expr")
+	}
+
+	return nil
+}
+
+// diffuseErrors visits every cell of a width×height grid row by row, passing
+// quantize its value of channels numbers with the error diffused from the
+// cells before it added, and spreads the error quantize returns over the
+// cells after it. With serpentine every other row runs right to left, with
+// the kernel mirrored, which breaks up the diagonal patterns of scanning in
+// one direction.
+func diffuseErrors(width, height, channels int, kernel []diffusionWeight, serpentine bool, value func(x, y int) []float64, quantize func(x, y int, value []float64) []float64) {
+	errors := make([][]float64, height)
+
+	for y := range errors {
+		errors[y] = make([]float64, width*channels)
+	}
+
+	for y := 0; y < height; y++ {
+		start, end, step := 0, width, 1
+
+		if serpentine && y%2 == 1 {
+			start, end, step = width-1, -1, -1
+		}
+
+		for x := start; x != end; x += step {
+			current := value(x, y)
+
+			for c := range current {
+				current[c] += errors[y][x*channels+c]
+			}
+
+			residual := quantize(x, y, current)
+
+			for _, w := range kernel {
+				nx, ny := x+w.DX*step, y+w.DY
+
+				if nx < 0 || nx >= width || ny >= height {
+					continue
+				}
+
+				for c, e := range residual {
+					errors[ny][nx*channels+c] += e * w.Weight
+				}
+			}
+		}
+	}
+}
+
+// rampLevels returns the luminance each character of the ramp stands for:
+// 0 for the first, 1 for the last and, with bounds, the middle of its band
+// for the others.
+func rampLevels(ramp Ramp) []float64 {
+	levels := make([]float64, len(ramp.Chars))
+
+	for i := range levels {
+		switch {
+		case len(levels) < 2:
+		case ramp.Bounds == nil || i == len(levels)-1:
+			levels[i] = float64(i) / float64(len(levels)-1)
+		case i > 0:
+			levels[i] = (ramp.Bounds[i-1] + ramp.Bounds[i]) / 2
+		}
+	}
+
+	return levels
+}
+
+// nearestLevel returns the index of the level closest to value.
+func nearestLevel(levels []float64, value float64) int {
+	best := 0
+
+	for i, level := range levels {
+		if math.Abs(level-value) < math.Abs(levels[best]-value) {
+			best = i
+		}
+	}
+
+	return best
+}
+
+// checkThreshold validates --threshold, --otsu and --posterize.
+func checkThreshold(opts *Options) error {
+	if opts.Threshold != nil && opts.Otsu {
+		return fmt.Errorf("--threshold cannot be combined with --otsu")
+	}
+
+	if opts.Threshold != nil && !(*opts.Threshold >= 0 && *opts.Threshold <= 1) {
+		return fmt.Errorf("--threshold must be between 0 and 1, got %g", *opts.Threshold)
+	}
+
+	if (opts.Threshold != nil || opts.Otsu) && len(opts.MapExpr) > 0 {
+		return fmt.Errorf("--threshold and --otsu cannot be combined with --map-expr")
+	}
+
+	if opts.Posterize != 0 {
+		if opts.Posterize < 2 {
+			return fmt.Errorf("--posterize must be at least 2, got %d", opts.Posterize)
+		}
+
+		if opts.Mode != "ascii" {
+			return fmt.Errorf("--posterize only works with --mode=ascii")
+		}
+
+		if opts.Threshold != nil || opts.Otsu || len(opts.MapExpr) > 0 {
+			return fmt.Errorf("--posterize cannot be combined with --threshold, --otsu or --map-expr")
+		}
+	}
+
+	return nil
+}
+
+// resolveThreshold returns the luminance --threshold or --otsu divides the
+// pixels of the image at, and whether either was given. Without them braille
+// and the block modes divide at 0.5.
+func resolveThreshold(img image.Image, opts *Options) (float64, bool) {
+	if opts.Threshold != nil {
+		return *opts.Threshold, true
+	}
+
+	if !opts.Otsu {
+		return 0.5, false
+	}
+
+	threshold := otsuThreshold(img, opts.LumaFormula)
+
+	if opts.Verbose {
+		fmt.Printf("VERBOSE: Otsu's method picked a threshold of %.3f\n", threshold)
+	}
+
+	return threshold, true
+}
+
+// otsuThreshold picks the luminance that best splits the pixels of the image
+// in two groups, the one with the largest variance between their means.
+func otsuThreshold(img image.Image, formula lumaFormula) float64 {
+	histogram, total := lumHistogram(img, formula)
+	sum := 0.0
+
+	for bin, pixels := range histogram {
+		sum += float64(bin * pixels)
+	}
+
+	best, bestVariance := 128, -1.0
+	darkSum, dark := 0.0, 0
+
+	for bin, pixels := range histogram {
+		if dark += pixels; dark == 0 || dark == total {
+			continue
+		}
+
+		darkSum += float64(bin * pixels)
+		darkMean := darkSum / float64(dark)
+		lightMean := (sum - darkSum) / float64(total-dark)
+		variance := float64(dark) * float64(total-dark) * (darkMean - lightMean) * (darkMean - lightMean)
+
+		if variance > bestVariance {
+			best, bestVariance = bin+1, variance
+		}
+	}
+
+	return float64(best) / 255
+}
+
+// quantizeRamp reduces the ramp to its darkest and brightest characters
+// for --threshold, with a pick that divides at the threshold, or to the
+// characters of --posterize evenly spaced levels. Otherwise the pick is the
+// nearest level of the ramp.
+func quantizeRamp(charset Ramp, threshold float64, thresholded bool, posterize int) ([]rune, []float64, func(value float64) int) {
+	if thresholded {
+		chars := []rune{charset.Chars[0], charset.Chars[len(charset.Chars)-1]}
+
+		return chars, []float64{0, 1}, func(value float64) int {
+			if value >= threshold {
+				return 1
+			}
+
+			return 0
+		}
+	}
+
+	if posterize > 1 {
+		chars, levels := make([]rune, posterize), make([]float64, posterize)
+
+		for i := range levels {
+			levels[i] = float64(i) / float64(posterize-1)
+			chars[i] = charset.Char(levels[i])
+		}
+
+		return chars, levels, func(value float64) int {
+			return int(math.Round(math.Max(0, math.Min(1, value)) * float64(posterize-1)))
+		}
+	}
+
+	levels := rampLevels(charset)
+
+	return charset.Chars, levels, func(value float64) int { return nearestLevel(levels, value) }
+}
+
+// ditherCells picks the character of every cell with the --dither method, so
+// that areas between two levels of the ramp mix the characters either side
+// instead of banding. With a threshold it dithers between the darkest and
+// brightest characters and with --posterize between its levels, and without
+// a --dither it only applies those.
+func ditherCells(cells [][]Cell, charset Ramp, threshold float64, thresholded bool, opts *Options) {
+	if len(cells) < 1 {
+		return
+	}
+
+	chars, levels, pick := quantizeRamp(charset, threshold, thresholded, opts.Posterize)
+
+	if opts.Dither == "none" {
+		for _, row := range cells {
+			for x := range row {
+				row[x].Char = chars[pick(row[x].Lum)]
+			}
+		}
+
+		return
+	}
+
+	if opts.Dither == "ordered" {
+		// The threshold map spans one step between levels, so it dithers
+		// ramps of any length. It only depends on the position, so flat
+		// areas look the same in every frame of an animation.
+		step := 1.0
+
+		if len(levels) > 1 {
+			step /= float64(len(levels) - 1)
+		}
+
+		for y, row := range cells {
+			for x := range row {
+				offset := ((bayerMatrix[y%8][x%8]+0.5)/64 - 0.5) * step * opts.DitherStrength
+
+				row[x].Char = chars[pick(row[x].Lum+offset)]
+			}
+		}
+
+		return
+	}
+
+	diffuseErrors(len(cells[0]), len(cells), 1, diffusionKernels[opts.Dither], opts.DitherSerpentine,
+		func(x, y int) []float64 { return []float64{cells[y][x].Lum} },
+		func(x, y int, value []float64) []float64 {
+			best := pick(value[0])
+
+			cells[y][x].Char = chars[best]
+
+			return []float64{value[0] - levels[best]}
+		})
+}
+
+// posterizeCells reduces the colors of the cells to --posterize levels per
+// channel with --posterize-color, and reports how many characters are left.
+func posterizeCells(cells [][]Cell, opts *Options) {
+	used := make(map[rune]bool)
+	steps := float64(opts.Posterize - 1)
+	level := func(v uint8) uint8 { return uint8(math.Round(math.Round(float64(v)/255*steps) / steps * 255)) }
+
+	for _, row := range cells {
+		for x := range row {
+			used[row[x].Char] = true
+
+			if opts.PosterizeColor {
+				c := row[x].Color
+				row[x].Color = color.NRGBA{level(c.R), level(c.G), level(c.B), c.A}
+			}
+		}
+	}
+
+	if opts.Verbose {
+		fmt.Printf("VERBOSE: Posterized to %d levels, using %d distinct characters\n", opts.Posterize, len(used))
+	}
+}
+
+// paletteLevels is roughly how many levels each channel has in the palettes
+// colors can be dithered to, which sets the span of ordered dithering.
+var paletteLevels = map[string]float64{
+	"ansi16":  2,
+	"ansi256": 6,
+}
+
+// ditherColors snaps the color of every cell to the --color palette with the
+// --dither method, spreading the difference over the channels of the cells
+// around it, so gradients mix palette colors instead of banding. The
+// characters are dithered on their own, from the luminance.
+func ditherColors(cells [][]Cell, opts *Options) {
+	if len(cells) < 1 {
+		return
+	}
+
+	clamp := func(v float64) uint8 { return uint8(math.Round(math.Max(0, math.Min(255, v)))) }
+	snap := func(x, y int, value []float64) []float64 {
+		cell := &cells[y][x]
+		c := color.NRGBA{clamp(value[0]), clamp(value[1]), clamp(value[2]), cell.Color.A}
+		cell.Color = paletteColor(c, luminance(c, opts.LumaFormula), opts)
+
+		return []float64{value[0] - float64(cell.Color.R), value[1] - float64(cell.Color.G), value[2] - float64(cell.Color.B)}
+	}
+
+	if opts.Dither == "ordered" {
+		step := 255 / (paletteLevels[opts.Color] - 1) * opts.DitherStrength
+
+		for y, row := range cells {
+			for x := range row {
+				offset := ((bayerMatrix[y%8][x%8]+0.5)/64 - 0.5) * step
+				c := row[x].Color
+
+				snap(x, y, []float64{float64(c.R) + offset, float64(c.G) + offset, float64(c.B) + offset})
+			}
+		}
+
+		return
+	}
+
+	diffuseErrors(len(cells[0]), len(cells), 3, diffusionKernels[opts.Dither], opts.DitherSerpentine,
+		func(x, y int) []float64 {
+			c := cells[y][x].Color
+
+			return []float64{float64(c.R), float64(c.G), float64(c.B)}
+		}, snap)
+}
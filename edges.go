@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// checkEdges validates the --edges and --edges-only options.
+func checkEdges(opts *Options) error {
+	if opts.EdgesOnly && opts.Mode != "ascii" {
+		return fmt.Errorf("--edges-only only works with --mode=ascii")
+	}
+
+	if !(opts.EdgeBlend >= 0 && opts.EdgeBlend <= 1) {
+		return fmt.Errorf("--edge-blend must be between 0 and 1, got %g", opts.EdgeBlend)
+	}
+
+	if !opts.Edges {
+		return nil
+	}
+
+	if opts.Mode != "ascii" {
+		return fmt.Errorf("--edges only works with --mode=ascii")
+	}
+
+	if count := len([]rune(opts.EdgeChars)); count != 8 {
+		return fmt.Errorf("--edge-chars needs 8 characters, got %d", count)
+	}
+
+	if opts.EdgeThreshold <= 0 {
+		return fmt.Errorf("--edge-threshold must be above 0, got %g", opts.EdgeThreshold)
+	}
+
+	return nil
+}
+
+// sobel returns the Sobel gradient of the luminance of the image at a pixel,
+// repeating the pixels at the border outwards so the edge of the image is
+// not taken for an edge in it.
+func sobel(img image.Image, formula lumaFormula) func(x, y int) (float64, float64) {
+	bounds := img.Bounds()
+	size := bounds.Size()
+	lum := make([][]float64, size.Y)
+
+	for y := range lum {
+		lum[y] = make([]float64, size.X)
+
+		for x := range lum[y] {
+			lum[y][x] = luminance(img.At(bounds.Min.X+x, bounds.Min.Y+y), formula)
+		}
+	}
+
+	at := func(x, y int) float64 {
+		if x < 0 {
+			x = 0
+		} else if x >= size.X {
+			x = size.X - 1
+		}
+
+		if y < 0 {
+			y = 0
+		} else if y >= size.Y {
+			y = size.Y - 1
+		}
+
+		return lum[y][x]
+	}
+
+	return func(x, y int) (float64, float64) {
+		gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+		gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+
+		return gx, gy
+	}
+}
+
+// edgeMagnitude scales a Sobel gradient so a sharp black to white step has a
+// magnitude of 1, as the kernels weigh 4 on each side.
+func edgeMagnitude(gx, gy float64) float64 {
+	return math.Hypot(gx, gy) / 4
+}
+
+// applyEdgesOnly maps the characters of the cells from the strength of the
+// edge at every pixel rather than its luminance, so strong edges get the
+// dense characters, mixed with the luminance by --edge-blend.
+func applyEdgesOnly(cells [][]Cell, img image.Image, charset Ramp, opts *Options) {
+	gradient := sobel(img, opts.LumaFormula)
+
+	for y, row := range cells {
+		for x := range row {
+			edge := math.Min(1, edgeMagnitude(gradient(x, y)))
+
+			row[x].Lum = opts.EdgeBlend*edge + (1-opts.EdgeBlend)*row[x].Lum
+			row[x].Char = charset.Char(row[x].Lum)
+		}
+	}
+}
+
+// applyEdges replaces the character of every cell on a strong luminance
+// gradient with the --edge-chars glyph for the direction of the gradient.
+// The eight glyphs are for gradients pointing east, north-east, north and so
+// on counterclockwise, where the gradient points from dark to bright.
+func applyEdges(cells [][]Cell, img image.Image, opts *Options) {
+	size := img.Bounds().Size()
+	glyphs := []rune(opts.EdgeChars)
+	gradient := sobel(img, opts.LumaFormula)
+
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			gx, gy := gradient(x, y)
+
+			if edgeMagnitude(gx, gy) < opts.EdgeThreshold {
+				continue
+			}
+
+			sector := int(math.Round(math.Atan2(-gy, gx)/(math.Pi/4))) & 7
+
+			cells[y][x].Char = glyphs[sector]
+		}
+	}
+}
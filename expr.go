@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// exprEnv holds the variables a --map-expr expression can read for a cell.
+type exprEnv struct {
+	Lum, R, G, B, X, Y, Width, Height float64
+}
+
+var exprVariables = map[string]func(env *exprEnv) float64{
+	"lum":    func(env *exprEnv) float64 { return env.Lum },
+	"r":      func(env *exprEnv) float64 { return env.R },
+	"g":      func(env *exprEnv) float64 { return env.G },
+	"b":      func(env *exprEnv) float64 { return env.B },
+	"x":      func(env *exprEnv) float64 { return env.X },
+	"y":      func(env *exprEnv) float64 { return env.Y },
+	"width":  func(env *exprEnv) float64 { return env.Width },
+	"height": func(env *exprEnv) float64 { return env.Height },
+	"pi":     func(env *exprEnv) float64 { return math.Pi },
+}
+
+type exprFunction struct {
+	Arity int
+	Call  func(args []float64) float64
+}
+
+var exprFunctions = map[string]exprFunction{
+	"abs":   {1, func(args []float64) float64 { return math.Abs(args[0]) }},
+	"sqrt":  {1, func(args []float64) float64 { return math.Sqrt(args[0]) }},
+	"floor": {1, func(args []float64) float64 { return math.Floor(args[0]) }},
+	"ceil":  {1, func(args []float64) float64 { return math.Ceil(args[0]) }},
+	"sin":   {1, func(args []float64) float64 { return math.Sin(args[0]) }},
+	"cos":   {1, func(args []float64) float64 { return math.Cos(args[0]) }},
+	"exp":   {1, func(args []float64) float64 { return math.Exp(args[0]) }},
+	"log":   {1, func(args []float64) float64 { return math.Log(args[0]) }},
+	"min":   {2, func(args []float64) float64 { return math.Min(args[0], args[1]) }},
+	"max":   {2, func(args []float64) float64 { return math.Max(args[0], args[1]) }},
+	"pow":   {2, func(args []float64) float64 { return math.Pow(args[0], args[1]) }},
+	"clamp": {3, func(args []float64) float64 { return math.Max(args[1], math.Min(args[2], args[0])) }},
+}
+
+// Expr is a compiled --map-expr expression.
+type Expr struct {
+	Source string
+	eval   func(env *exprEnv) float64
+}
+
+type exprParser struct {
+	source string
+	tokens []string
+	starts []int
+	pos    int
+}
+
+func tokenizeExpr(source string) ([]string, []int, error) {
+	tokens, starts := make([]string, 0), make([]int, 0)
+
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		start := i
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+			continue
+		case unicode.IsDigit(c) || c == '.':
+			for i < len(source) && (unicode.IsDigit(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+
+			// Exponents such as 1e-3.
+			if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+				i++
+
+				if i < len(source) && (source[i] == '+' || source[i] == '-') {
+					i++
+				}
+
+				for i < len(source) && unicode.IsDigit(rune(source[i])) {
+					i++
+				}
+			}
+		case unicode.IsLetter(c) || c == '_':
+			for i < len(source) && (unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i])) || source[i] == '_') {
+				i++
+			}
+		case strings.ContainsRune("+-*/%^(),", c):
+			i++
+		default:
+			return nil, nil, fmt.Errorf("unexpected %q at position %d", c, i+1)
+		}
+
+		tokens, starts = append(tokens, source[start:i]), append(starts, start)
+	}
+
+	return tokens, starts, nil
+}
+
+// compileExpr parses an expression of numbers, the exprVariables, the
+// exprFunctions, parentheses and the operators + - * / % and ^ into a
+// function that is evaluated for every cell without parsing it again.
+func compileExpr(source string) (*Expr, error) {
+	tokens, starts, err := tokenizeExpr(source)
+
+	if err != nil {
+		return nil, fmt.Errorf("--map-expr %q: %w", source, err)
+	}
+
+	parser := &exprParser{source: source, tokens: tokens, starts: starts}
+	eval, err := parser.sum()
+
+	if err == nil && parser.pos < len(tokens) {
+		err = parser.unexpected()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("--map-expr %q: %w", source, err)
+	}
+
+	return &Expr{Source: source, eval: eval}, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *exprParser) unexpected() error {
+	if p.pos >= len(p.tokens) {
+		return fmt.Errorf("unexpected end of expression")
+	}
+
+	return fmt.Errorf("unexpected %q at position %d", p.tokens[p.pos], p.starts[p.pos]+1)
+}
+
+func (p *exprParser) expect(token string) error {
+	if p.peek() != token {
+		return p.unexpected()
+	}
+
+	p.pos++
+
+	return nil
+}
+
+func (p *exprParser) sum() (func(env *exprEnv) float64, error) {
+	left, err := p.term()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.peek()
+		p.pos++
+		right, err := p.term()
+
+		if err != nil {
+			return nil, err
+		}
+
+		a, b := left, right
+
+		if op == "+" {
+			left = func(env *exprEnv) float64 { return a(env) + b(env) }
+		} else {
+			left = func(env *exprEnv) float64 { return a(env) - b(env) }
+		}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) term() (func(env *exprEnv) float64, error) {
+	left, err := p.unary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "*" || p.peek() == "/" || p.peek() == "%" {
+		op := p.peek()
+		p.pos++
+		right, err := p.unary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		a, b := left, right
+
+		switch op {
+		case "*":
+			left = func(env *exprEnv) float64 { return a(env) * b(env) }
+		case "/":
+			left = func(env *exprEnv) float64 { return a(env) / b(env) }
+		default:
+			left = func(env *exprEnv) float64 { return math.Mod(a(env), b(env)) }
+		}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) unary() (func(env *exprEnv) float64, error) {
+	if p.peek() == "-" {
+		p.pos++
+		operand, err := p.unary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func(env *exprEnv) float64 { return -operand(env) }, nil
+	}
+
+	return p.power()
+}
+
+func (p *exprParser) power() (func(env *exprEnv) float64, error) {
+	base, err := p.atom()
+
+	if err != nil || p.peek() != "^" {
+		return base, err
+	}
+
+	p.pos++
+	exponent, err := p.unary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(env *exprEnv) float64 { return math.Pow(base(env), exponent(env)) }, nil
+}
+
+func (p *exprParser) atom() (func(env *exprEnv) float64, error) {
+	token := p.peek()
+
+	switch {
+	case token == "(":
+		p.pos++
+		inner, err := p.sum()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return inner, p.expect(")")
+	case len(token) > 0 && (unicode.IsDigit(rune(token[0])) || token[0] == '.'):
+		value, err := strconv.ParseFloat(token, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", token, p.starts[p.pos]+1)
+		}
+
+		p.pos++
+
+		return func(env *exprEnv) float64 { return value }, nil
+	case len(token) > 0 && (unicode.IsLetter(rune(token[0])) || token[0] == '_'):
+		start := p.starts[p.pos]
+		p.pos++
+
+		if p.peek() != "(" {
+			variable, ok := exprVariables[token]
+
+			if !ok {
+				return nil, fmt.Errorf("unknown variable %q at position %d", token, start+1)
+			}
+
+			return variable, nil
+		}
+
+		function, ok := exprFunctions[token]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown function %q at position %d", token, start+1)
+		}
+
+		p.pos++
+		args := make([]func(env *exprEnv) float64, 0, function.Arity)
+
+		for p.peek() != ")" {
+			if len(args) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+
+			arg, err := p.sum()
+
+			if err != nil {
+				return nil, err
+			}
+
+			args = append(args, arg)
+		}
+
+		p.pos++
+
+		if len(args) != function.Arity {
+			return nil, fmt.Errorf("%s at position %d takes %d arguments, got %d", token, start+1, function.Arity, len(args))
+		}
+
+		return func(env *exprEnv) float64 {
+			values := make([]float64, len(args))
+
+			for i, arg := range args {
+				values[i] = arg(env)
+			}
+
+			return function.Call(values)
+		}, nil
+	}
+
+	return nil, p.unexpected()
+}
+
+// applyMapExpr picks the character of every cell from the value of the
+// expression instead of its luminance. Values outside 0 to 1 are an error.
+func applyMapExpr(cells [][]Cell, img image.Image, charset Ramp, expr *Expr) error {
+	bounds := img.Bounds()
+	env := &exprEnv{Width: float64(bounds.Dx()), Height: float64(bounds.Dy())}
+
+	for y, row := range cells {
+		for x := range row {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+
+			env.Lum, env.X, env.Y = row[x].Lum, float64(x), float64(y)
+			env.R, env.G, env.B = float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+
+			value := expr.eval(env)
+
+			if !(value >= 0 && value <= 1) {
+				return fmt.Errorf("--map-expr %q gives %g at %d,%d, which is outside 0 to 1", expr.Source, value, x, y)
+			}
+
+			row[x].Char = charset.Char(value)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+const farbfeldMagic = "farbfeld"
+
+func init() {
+	image.RegisterFormat("farbfeld", farbfeldMagic, decodeFarbfeld, decodeFarbfeldConfig)
+}
+
+func decodeFarbfeldConfig(r io.Reader) (image.Config, error) {
+	header := make([]byte, 16)
+
+	if n, err := io.ReadFull(r, header); err != nil {
+		return image.Config{}, fmt.Errorf("farbfeld header truncated at byte offset %d", n)
+	}
+
+	if string(header[:8]) != farbfeldMagic {
+		return image.Config{}, errors.New("invalid farbfeld magic")
+	}
+
+	return image.Config{
+		ColorModel: color.NRGBA64Model,
+		Width:      int(binary.BigEndian.Uint32(header[8:])),
+		Height:     int(binary.BigEndian.Uint32(header[12:])),
+	}, nil
+}
+
+func decodeFarbfeld(r io.Reader) (image.Image, error) {
+	config, err := decodeFarbfeldConfig(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Width < 1 || config.Height < 1 || config.Width > 1<<15 || config.Height > 1<<15 {
+		return nil, fmt.Errorf("invalid farbfeld dimensions: %dx%d", config.Width, config.Height)
+	}
+
+	// Farbfeld pixels are big-endian, non-premultiplied 16-bit RGBA, which
+	// is exactly the in-memory layout of image.NRGBA64. The buffer grows as
+	// the data arrives, so a header claiming more pixels than the file holds
+	// cannot allocate them up front.
+	size := int64(config.Width) * int64(config.Height) * 8
+	pix := &bytes.Buffer{}
+
+	if n, err := io.CopyN(pix, r, size); err != nil {
+		return nil, fmt.Errorf("farbfeld pixel data truncated at byte offset %d", 16+n)
+	}
+
+	return &image.NRGBA64{Pix: pix.Bytes(), Stride: config.Width * 8, Rect: image.Rect(0, 0, config.Width, config.Height)}, nil
+}
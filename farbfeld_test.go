@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"runtime"
+	"testing"
+)
+
+// farbfeldHeader returns the header of a farbfeld image of the given size.
+func farbfeldHeader(width, height uint32) []byte {
+	header := make([]byte, 16)
+
+	copy(header, farbfeldMagic)
+	binary.BigEndian.PutUint32(header[8:], width)
+	binary.BigEndian.PutUint32(header[12:], height)
+
+	return header
+}
+
+func TestDecodeFarbfeld(t *testing.T) {
+	data := farbfeldHeader(2, 1)
+	data = append(data, 0xff, 0xff, 0, 0, 0, 0, 0xff, 0xff, 0, 0, 0x80, 0x00, 0, 0, 0x80, 0x00)
+	img, err := decodeFarbfeld(bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x, want := range []color.NRGBA64{{0xffff, 0, 0, 0xffff}, {0, 0x8000, 0, 0x8000}} {
+		if c := img.At(x, 0); c != want {
+			t.Errorf("pixel %d is %v, want %v", x, c, want)
+		}
+	}
+}
+
+func TestDecodeFarbfeldTruncated(t *testing.T) {
+	// A 32768x32768 header would need 8 GiB of pixels.
+	data := append(farbfeldHeader(1<<15, 1<<15), make([]byte, 64)...)
+
+	var before, after runtime.MemStats
+
+	runtime.ReadMemStats(&before)
+
+	if _, err := decodeFarbfeld(bytes.NewReader(data)); err == nil {
+		t.Fatal("decodeFarbfeld accepted truncated pixel data")
+	}
+
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("decoding allocated %d bytes for 64 bytes of data", allocated)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+)
+
+// fitBox returns the columns and rows --fit fills: the terminal on standard
+// output less a row for the prompt, or --fit-width columns of any height when
+// standard output is not a terminal.
+func fitBox(opts *Options) (image.Point, error) {
+	if opts.FitWidth < 1 {
+		return image.Point{}, fmt.Errorf("--fit-width must be at least 1, got %d", opts.FitWidth)
+	}
+
+	if columns, rows, ok := terminalSize(os.Stdout); ok {
+		if rows > 1 {
+			rows--
+		}
+
+		return image.Point{columns, rows}, nil
+	}
+
+	return image.Point{opts.FitWidth, 0}, nil
+}
+
+// fitSize returns the largest size in columns and rows that fits into box
+// and keeps the proportions of an image of the given size, taking into
+// account the width to height ratio of a cell. A box without rows only
+// limits the width.
+func fitSize(size, box image.Point, cellAspect float64) (int, int) {
+	aspect := float64(size.X) / float64(size.Y) / cellAspect
+	columns, rows := float64(box.X), float64(box.X)/aspect
+
+	if box.Y > 0 && rows > float64(box.Y) {
+		columns, rows = float64(box.Y)*aspect, float64(box.Y)
+	}
+
+	return int(math.Max(1, math.Round(columns))), int(math.Max(1, math.Round(rows)))
+}
+
+// limitSize shrinks a resize of width×height pixels, made into cells of the
+// given size that each take the given number of columns, until the art fits
+// --max-width and --max-height. It never enlarges the art.
+func limitSize(width, height, columns int, cell image.Point, opts *Options) (int, int) {
+	artColumns, artRows := width/cell.X*columns, (height+cell.Y-1)/cell.Y
+	factor := 1.0
+
+	if opts.MaxWidth > 0 && artColumns > opts.MaxWidth {
+		factor = float64(opts.MaxWidth) / float64(artColumns)
+	}
+
+	if opts.MaxHeight > 0 && artRows > opts.MaxHeight {
+		factor = math.Min(factor, float64(opts.MaxHeight)/float64(artRows))
+	}
+
+	if factor >= 1 {
+		return width, height
+	}
+
+	// Whole cells keep the limits from being overshot by rounding.
+	cellsX := int(math.Max(1, math.Floor(float64(width/cell.X)*factor)))
+	cellsY := int(math.Max(1, math.Floor(float64(artRows)*factor)))
+
+	if opts.Verbose {
+		fmt.Printf("VERBOSE: Limited the art from %dx%d to %dx%d characters to fit --max-width and --max-height\n", artColumns, artRows, cellsX*columns, cellsY)
+	}
+
+	return cellsX * cell.X, cellsY * cell.Y
+}
+
+// checkSize refuses art of more than --max-cells characters, which would take
+// a long time and a lot of memory, unless --force-large is given.
+func checkSize(width, height, columns int, cell image.Point, opts *Options) error {
+	cells := float64(width/cell.X*columns) * float64((height+cell.Y-1)/cell.Y)
+
+	if opts.ForceLarge || cells <= float64(opts.MaxCells) {
+		return nil
+	}
+
+	return fmt.Errorf("the art would be %dx%d characters, more than --max-cells %d; pass --force-large to convert it anyway", width/cell.X*columns, (height+cell.Y-1)/cell.Y, opts.MaxCells)
+}
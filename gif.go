@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/gif"
+	"time"
+)
+
+func decodeGIF(data []byte) ([]Frame, error) {
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+
+	if len(anim.Image) == 1 && anim.Image[0].Bounds() == bounds {
+		return []Frame{{Image: anim.Image[0], Delay: gifDelay(anim, 0)}}, nil
+	}
+
+	frames := make([]Frame, 0, len(anim.Image))
+	canvas := image.NewNRGBA(bounds)
+
+	for i, img := range anim.Image {
+		var disposal byte = gif.DisposalNone
+
+		if i < len(anim.Disposal) {
+			disposal = anim.Disposal[i]
+		}
+
+		var previous *image.NRGBA = nil
+
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewNRGBA(bounds)
+
+			draw.Draw(previous, bounds, canvas, image.Point{}, draw.Src)
+		}
+
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+
+		frame := image.NewNRGBA(bounds)
+
+		draw.Draw(frame, bounds, canvas, image.Point{}, draw.Src)
+
+		frames = append(frames, Frame{Image: frame, Delay: gifDelay(anim, i)})
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return frames, nil
+}
+
+func gifDelay(anim *gif.GIF, index int) time.Duration {
+	if index >= len(anim.Delay) {
+		return 0
+	}
+
+	return time.Duration(anim.Delay[index]) * 10 * time.Millisecond
+}
@@ -1,7 +1,15 @@
-module main
+module github.com/passthemayo/asciify
 
 go 1.18
 
-require github.com/jessevdk/go-flags v1.5.0
+require (
+	github.com/jessevdk/go-flags v1.5.0
+	github.com/mattn/go-runewidth v0.0.13
+	golang.org/x/image v0.0.0-20220413100746-70e8d0d3baa9
+	golang.org/x/sys v0.0.0-20210320140829-1e4c9ba3b0c4
+)
 
-require golang.org/x/sys v0.0.0-20210320140829-1e4c9ba3b0c4 // indirect
+require (
+	github.com/rivo/uniseg v0.2.0 // indirect
+	golang.org/x/text v0.3.6 // indirect
+)
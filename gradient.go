@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// colorStop is a color of a --colorize gradient and the luminance it is at.
+type colorStop struct {
+	Position float64
+	Color    labColor
+}
+
+// colorizePresets are the built-in --colorize gradients.
+var colorizePresets = map[string]string{
+	"viridis": "#440154,#3b528b,#21918c,#5ec962,#fde725",
+	"magma":   "#000004,#3b0f70,#8c2981,#de4968,#fe9f6d,#fcfdbf",
+	"amber":   "#000000,#ffb000",
+}
+
+// parseGradient parses a --colorize value: a preset name, or two or more
+// comma separated colors, each optionally prefixed with its position from 0
+// to 1 and an equals sign, where dark and light stand for 0 and 1. Colors
+// without a position are spread evenly between the stops around them.
+func parseGradient(value string) ([]colorStop, error) {
+	if preset, ok := colorizePresets[value]; ok {
+		value = preset
+	}
+
+	entries := strings.Split(value, ",")
+
+	if len(entries) < 2 {
+		names := make([]string, 0, len(colorizePresets))
+
+		for name := range colorizePresets {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("needs a preset (%s) or at least 2 colors, got %q", strings.Join(names, ", "), value)
+	}
+
+	stops := make([]colorStop, len(entries))
+	positioned := make([]bool, len(entries))
+
+	for i, entry := range entries {
+		entry = strings.TrimSpace(entry)
+
+		if j := strings.IndexByte(entry, '='); j >= 0 {
+			key := strings.TrimSpace(entry[:j])
+			entry = strings.TrimSpace(entry[j+1:])
+
+			switch key {
+			case "dark":
+				stops[i].Position = 0
+			case "light":
+				stops[i].Position = 1
+			default:
+				position, err := strconv.ParseFloat(key, 64)
+
+				if err != nil || !(position >= 0 && position <= 1) {
+					return nil, fmt.Errorf("invalid stop position %q, must be dark, light or 0 to 1", key)
+				}
+
+				stops[i].Position = position
+			}
+
+			positioned[i] = true
+		}
+
+		c, err := parseHexColor(entry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stops[i].Color = toLab(c)
+	}
+
+	if !positioned[0] {
+		stops[0].Position, positioned[0] = 0, true
+	}
+
+	if last := len(stops) - 1; !positioned[last] {
+		stops[last].Position, positioned[last] = 1, true
+	}
+
+	for i := 1; i < len(stops); i++ {
+		if !positioned[i] {
+			continue
+		}
+
+		previous := i - 1
+
+		for !positioned[previous] {
+			previous--
+		}
+
+		if stops[i].Position < stops[previous].Position {
+			return nil, fmt.Errorf("stop positions must not decrease, got %g after %g", stops[i].Position, stops[previous].Position)
+		}
+
+		for j := previous + 1; j < i; j++ {
+			stops[j].Position = stops[previous].Position + (stops[i].Position-stops[previous].Position)*float64(j-previous)/float64(i-previous)
+		}
+	}
+
+	return stops, nil
+}
+
+// checkColorize validates --colorize and parses its gradient.
+func checkColorize(opts *Options) error {
+	if len(opts.Colorize) < 1 {
+		return nil
+	}
+
+	if !colorEnabled(opts) {
+		return fmt.Errorf("--colorize needs a color mode, e.g. --color=truecolor")
+	}
+
+	stops, err := parseGradient(opts.Colorize)
+
+	if err != nil {
+		return fmt.Errorf("--colorize: %w", err)
+	}
+
+	opts.ColorizeStops = stops
+
+	return nil
+}
+
+// gradientColor interpolates the gradient at a luminance in L*a*b*, so the
+// colors between two stops are as far from each as they look rather than
+// the muddy mix of their RGB channels.
+func gradientColor(stops []colorStop, lum float64) color.NRGBA {
+	if !(lum > stops[0].Position) {
+		return fromLab(stops[0].Color)
+	}
+
+	for i := 1; i < len(stops); i++ {
+		a, b := stops[i-1], stops[i]
+
+		if lum > b.Position {
+			continue
+		}
+
+		t := 0.0
+
+		if b.Position > a.Position {
+			t = (lum - a.Position) / (b.Position - a.Position)
+		}
+
+		return fromLab(labColor{a.Color.L + (b.Color.L-a.Color.L)*t, a.Color.A + (b.Color.A-a.Color.A)*t, a.Color.B + (b.Color.B-a.Color.B)*t})
+	}
+
+	return fromLab(stops[len(stops)-1].Color)
+}
+
+// colorizeCells replaces the color of every cell with the --colorize
+// gradient at its luminance. Cells with a background, as in the block modes,
+// have both colors mapped from their own luminance.
+func colorizeCells(cells [][]Cell, opts *Options) {
+	stops := opts.ColorizeStops
+
+	for _, row := range cells {
+		for x := range row {
+			cell := &row[x]
+
+			if cell.Plain {
+				continue
+			}
+
+			lum := cell.Lum
+
+			if cell.Background != nil {
+				lum = luminance(cell.Color, opts.LumaFormula)
+				background := gradientColor(stops, luminance(*cell.Background, opts.LumaFormula))
+				background.A = cell.Background.A
+				cell.Background = &background
+			}
+
+			alpha := cell.Color.A
+			cell.Color = gradientColor(stops, lum)
+			cell.Color.A = alpha
+		}
+	}
+}
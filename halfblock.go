@@ -0,0 +1,37 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+const upperHalfBlock = '▀'
+
+// convertHalfblock draws two pixels per character with an upper half block,
+// the top pixel as its color and the bottom pixel as its background. The
+// bottom of an odd final row is left as the terminal background.
+func convertHalfblock(img image.Image, formula lumaFormula) [][]Cell {
+	bounds := img.Bounds()
+	size := bounds.Size()
+	cells := make([][]Cell, (size.Y+1)/2)
+
+	for y := range cells {
+		cells[y] = make([]Cell, size.X)
+
+		for x := 0; x < size.X; x++ {
+			top := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y*2)).(color.NRGBA)
+			cell := Cell{Char: upperHalfBlock, Color: top, Lum: luminance(top, formula)}
+
+			if bottomY := bounds.Min.Y + y*2 + 1; bottomY < bounds.Max.Y {
+				bottom := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bottomY)).(color.NRGBA)
+
+				cell.Background = &bottom
+				cell.Lum = (cell.Lum + luminance(bottom, formula)) / 2
+			}
+
+			cells[y][x] = cell
+		}
+	}
+
+	return cells
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// headerComments holds how formats with comments of their own open a block,
+// start each line of it and close it.
+var headerComments = map[string][3]string{
+	"html":     {"<!--\n", "", "-->\n"},
+	"svg":      {"<!--\n", "", "-->\n"},
+	"markdown": {"<!--\n", "", "-->\n"},
+	"latex":    {"", "% ", ""},
+	"go":       {"", "// ", "\n"},
+	"c":        {"/*\n", " * ", " */\n"},
+}
+
+// headerlessFormats cannot hold a comment without breaking the file.
+var headerlessFormats = map[string]bool{
+	"png":  true,
+	"pdf":  true,
+	"json": true,
+	"ans":  true,
+	"cast": true,
+}
+
+func headerLines(art Art, opts *Options) []string {
+	lines := []string{
+		fmt.Sprintf("asciify %s", version),
+		fmt.Sprintf("source: %s", art.Source),
+		fmt.Sprintf("source size: %dx%d", art.SourceSize.X, art.SourceSize.Y),
+		fmt.Sprintf("output size: %dx%d characters", artWidth(art), len(art.Cells)),
+		fmt.Sprintf("charset: %s", charsetName(opts)),
+		fmt.Sprintf("mode: %s", opts.Mode),
+	}
+
+	if len(opts.Resize) > 0 {
+		lines = append(lines, fmt.Sprintf("resize: %s", opts.Resize))
+	}
+
+	if opts.Scale != 0 {
+		lines = append(lines, fmt.Sprintf("scale: %g", opts.Scale))
+	}
+
+	return append(lines, fmt.Sprintf("color: %s", opts.Color))
+}
+
+// addHeader puts the --header comment at the start of output, after the XML
+// declaration of SVG output.
+func addHeader(output []byte, art Art, opts *Options) []byte {
+	if headerlessFormats[opts.Format] {
+		return output
+	}
+
+	comment, ok := headerComments[opts.Format]
+
+	if !ok {
+		comment = [3]string{"", opts.HeaderPrefix + " ", ""}
+	}
+
+	header := &bytes.Buffer{}
+
+	header.WriteString(comment[0])
+
+	for _, line := range headerLines(art, opts) {
+		if len(comment[0]) > 0 {
+			// Keep input names from closing the comment early.
+			line = strings.Replace(strings.Replace(line, "--", "- -", -1), "*/", "* /", -1)
+		}
+
+		header.WriteString(comment[1] + line + "\n")
+	}
+
+	header.WriteString(comment[2])
+
+	prologue := 0
+
+	if bytes.HasPrefix(output, []byte("<?xml")) {
+		prologue = bytes.IndexByte(output, '\n') + 1
+	}
+
+	result := make([]byte, 0, len(output)+header.Len())
+	result = append(result, output[:prologue]...)
+	result = append(result, header.Bytes()...)
+
+	return append(result, output[prologue:]...)
+}
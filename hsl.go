@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// checkColorAdjust validates the --saturation and --hue-rotate options.
+func checkColorAdjust(opts *Options) error {
+	if !(opts.Saturation >= 0) || math.IsInf(opts.Saturation, 0) {
+		return fmt.Errorf("--saturation must be a number of at least 0, got %g", opts.Saturation)
+	}
+
+	if math.IsNaN(opts.HueRotate) || math.IsInf(opts.HueRotate, 0) {
+		return fmt.Errorf("--hue-rotate must be a number of degrees, got %g", opts.HueRotate)
+	}
+
+	return nil
+}
+
+// toHSL converts a color to its hue in degrees and its saturation and
+// lightness from 0 to 1.
+func toHSL(c color.NRGBA) (float64, float64, float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	high, low := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	l := (high + low) / 2
+
+	if high == low {
+		return 0, 0, l
+	}
+
+	d := high - low
+	s := d / (1 - math.Abs(2*l-1))
+	var h float64
+
+	switch high {
+	case r:
+		h = math.Mod((g-b)/d+6, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+
+	return h * 60, s, l
+}
+
+// fromHSL converts a hue, saturation and lightness back to a color with the
+// given alpha.
+func fromHSL(h, s, l float64, alpha uint8) color.NRGBA {
+	chroma := (1 - math.Abs(2*l-1)) * s
+	h = math.Mod(math.Mod(h, 360)+360, 360) / 60
+	x := chroma * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+
+	switch int(h) {
+	case 0:
+		r, g = chroma, x
+	case 1:
+		r, g = x, chroma
+	case 2:
+		g, b = chroma, x
+	case 3:
+		g, b = x, chroma
+	case 4:
+		r, b = x, chroma
+	default:
+		r, b = chroma, x
+	}
+
+	m := l - chroma/2
+	channel := func(v float64) uint8 { return uint8(math.Round(math.Max(0, math.Min(1, v+m)) * 255)) }
+
+	return color.NRGBA{channel(r), channel(g), channel(b), alpha}
+}
+
+// adjustColors scales the saturation of the color and background of every
+// cell by --saturation and turns their hue by --hue-rotate degrees, leaving
+// the characters, picked from the luminance before, where they are.
+func adjustColors(cells [][]Cell, opts *Options) {
+	if opts.Saturation == 1 && math.Mod(opts.HueRotate, 360) == 0 {
+		return
+	}
+
+	adjust := func(c color.NRGBA) color.NRGBA {
+		h, s, l := toHSL(c)
+
+		return fromHSL(h+opts.HueRotate, math.Min(1, s*opts.Saturation), l, c.A)
+	}
+
+	for _, row := range cells {
+		for x := range row {
+			if row[x].Plain {
+				continue
+			}
+
+			row[x].Color = adjust(row[x].Color)
+
+			if row[x].Background != nil {
+				background := adjust(*row[x].Background)
+				row[x].Background = &background
+			}
+		}
+	}
+}
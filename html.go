@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image/color"
+)
+
+func renderHTML(art Art, opts *Options) ([]byte, error) {
+	background, err := parseHexColor(opts.HTMLBackground)
+
+	if err != nil {
+		return nil, fmt.Errorf("--html-background: %w", err)
+	}
+
+	foreground, err := parseHexColor(opts.HTMLForeground)
+
+	if err != nil {
+		return nil, fmt.Errorf("--html-foreground: %w", err)
+	}
+
+	if opts.HTMLClasses && colorEnabled(opts) {
+		return renderHTMLClasses(art, background, foreground, opts)
+	}
+
+	result := &bytes.Buffer{}
+
+	writeHTMLHeader(result, background, foreground, htmlWideStyle(art))
+
+	colored := colorEnabled(opts)
+
+	for y, row := range art.Cells {
+		for _, cell := range row {
+			char := htmlChar(cell.Char)
+
+			if colored && cell.Background != nil {
+				fmt.Fprintf(result, "<span style=\"color: %s; background-color: %s\">%s</span>", hexColor(displayColor(cell, opts)), hexColor(paletteColor(*cell.Background, luminance(*cell.Background, opts.LumaFormula), opts)), char)
+			} else if colored && !cell.Plain {
+				fmt.Fprintf(result, "<span style=\"color: %s\">%s</span>", hexColor(displayColor(cell, opts)), char)
+			} else {
+				result.WriteString(char)
+			}
+		}
+
+		if y+1 != len(art.Cells) {
+			result.WriteString("\n")
+		}
+	}
+
+	result.WriteString("</pre>\n</body>\n</html>\n")
+
+	return result.Bytes(), nil
+}
+
+// htmlWideStyle styles the spans wrapping wide characters so that they take
+// exactly two columns whatever width the browser's font gives them.
+func htmlWideStyle(art Art) string {
+	if artColumns(art) == artWidth(art) {
+		return ""
+	}
+
+	return ".w { display: inline-block; width: 2ch; text-align: center; }\n"
+}
+
+func htmlChar(char rune) string {
+	escaped := html.EscapeString(string(char))
+
+	if runeColumns(char) > 1 {
+		return "<span class=\"w\">" + escaped + "</span>"
+	}
+
+	return escaped
+}
+
+func writeHTMLHeader(result *bytes.Buffer, background, foreground color.NRGBA, style string) {
+	result.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>asciify</title>\n<style>\n")
+	fmt.Fprintf(result, "body { margin: 0; background: %s; }\n", hexColor(background))
+	fmt.Fprintf(result, "pre { margin: 0; padding: 1em; font-family: monospace; line-height: 1; background: %s; color: %s; }\n", hexColor(background), hexColor(foreground))
+	result.WriteString(style)
+	result.WriteString("</style>\n</head>\n<body>\n<pre>")
+}
+
+// quantizeColor keeps the given number of bits of every channel and
+// replicates them into the low bits so that full intensity stays 255.
+func quantizeColor(c color.NRGBA, bits int) color.NRGBA {
+	if bits >= 8 {
+		return c
+	}
+
+	quantize := func(value uint8) uint8 {
+		kept := value >> uint(8-bits)
+		result := 0
+
+		for shift := 8 - bits; shift > -bits; shift -= bits {
+			if shift >= 0 {
+				result |= int(kept) << uint(shift)
+			} else {
+				result |= int(kept) >> uint(-shift)
+			}
+		}
+
+		return uint8(result)
+	}
+
+	return color.NRGBA{quantize(c.R), quantize(c.G), quantize(c.B), c.A}
+}
+
+// htmlClass is the colors shared by the cells of one --html-classes class.
+type htmlClass struct {
+	Color, Background color.NRGBA
+	Filled            bool
+}
+
+func renderHTMLClasses(art Art, background, foreground color.NRGBA, opts *Options) ([]byte, error) {
+	if opts.HTMLPrecision < 1 || opts.HTMLPrecision > 8 {
+		return nil, fmt.Errorf("--html-precision must be between 1 and 8 bits, got %d", opts.HTMLPrecision)
+	}
+
+	classes := make(map[htmlClass]string)
+	order := make([]htmlClass, 0)
+	body := &bytes.Buffer{}
+
+	for y, row := range art.Cells {
+		current := ""
+
+		for _, cell := range row {
+			c := htmlClass{Color: quantizeColor(displayColor(cell, opts), opts.HTMLPrecision)}
+
+			if cell.Background != nil {
+				c.Background = quantizeColor(paletteColor(*cell.Background, luminance(*cell.Background, opts.LumaFormula), opts), opts.HTMLPrecision)
+				c.Filled = true
+			}
+
+			class, ok := classes[c]
+
+			if !ok {
+				class = fmt.Sprintf("c%x", len(order))
+				classes[c] = class
+				order = append(order, c)
+			}
+
+			if class != current {
+				if len(current) > 0 {
+					body.WriteString("</span>")
+				}
+
+				fmt.Fprintf(body, "<span class=\"%s\">", class)
+
+				current = class
+			}
+
+			body.WriteString(htmlChar(cell.Char))
+		}
+
+		if len(current) > 0 {
+			body.WriteString("</span>")
+		}
+
+		if y+1 != len(art.Cells) {
+			body.WriteString("\n")
+		}
+	}
+
+	style := bytes.NewBufferString(htmlWideStyle(art))
+
+	for _, c := range order {
+		if c.Filled {
+			fmt.Fprintf(style, ".%s { color: %s; background-color: %s; }\n", classes[c], hexColor(c.Color), hexColor(c.Background))
+		} else {
+			fmt.Fprintf(style, ".%s { color: %s; }\n", classes[c], hexColor(c.Color))
+		}
+	}
+
+	result := &bytes.Buffer{}
+
+	writeHTMLHeader(result, background, foreground, style.String())
+	result.Write(body.Bytes())
+	result.WriteString("</pre>\n</body>\n</html>\n")
+
+	return result.Bytes(), nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+const icoMagic = "\x00\x00\x01\x00"
+
+type icoEntry struct {
+	Width    int
+	Height   int
+	BitCount int
+	Data     []byte
+}
+
+func readICOEntries(data []byte) ([]icoEntry, error) {
+	if len(data) < 6 || string(data[:4]) != icoMagic {
+		return nil, errors.New("invalid ico header")
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+
+	if count < 1 {
+		return nil, errors.New("ico contains no images")
+	}
+
+	if 6+count*16 > len(data) {
+		return nil, errors.New("ico directory is truncated")
+	}
+
+	entries := make([]icoEntry, 0, count)
+
+	for i := 0; i < count; i++ {
+		entry := data[6+i*16 : 6+(i+1)*16]
+		size := int(binary.LittleEndian.Uint32(entry[8:]))
+		offset := int(binary.LittleEndian.Uint32(entry[12:]))
+
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return nil, fmt.Errorf("ico entry %d is out of bounds", i+1)
+		}
+
+		width, height := int(entry[0]), int(entry[1])
+
+		if width == 0 {
+			width = 256
+		}
+
+		if height == 0 {
+			height = 256
+		}
+
+		entries = append(entries, icoEntry{
+			Width:    width,
+			Height:   height,
+			BitCount: int(binary.LittleEndian.Uint16(entry[6:])),
+			Data:     data[offset : offset+size],
+		})
+	}
+
+	return entries, nil
+}
+
+func decodeICO(entries []icoEntry, opts *Options) (image.Image, error) {
+	selected := opts.IcoIndex - 1
+
+	if selected < 0 {
+		selected = 0
+
+		for i, entry := range entries {
+			largest := entries[selected]
+
+			if entry.Width*entry.Height > largest.Width*largest.Height || (entry.Width*entry.Height == largest.Width*largest.Height && entry.BitCount > largest.BitCount) {
+				selected = i
+			}
+		}
+	}
+
+	if opts.Verbose {
+		for i, entry := range entries {
+			marker := ""
+
+			if i == selected {
+				marker = " (selected)"
+			}
+
+			fmt.Printf("VERBOSE: ICO entry %d: %dx%d, %d bits per pixel%s\n", i+1, entry.Width, entry.Height, entry.BitCount, marker)
+		}
+	}
+
+	entry := entries[selected]
+
+	if bytes.HasPrefix(entry.Data, []byte(pngSignature)) {
+		return png.Decode(bytes.NewReader(entry.Data))
+	}
+
+	return decodeDIB(entry.Data)
+}
+
+func decodeDIB(data []byte) (image.Image, error) {
+	if len(data) < 40 {
+		return nil, errors.New("dib header is truncated")
+	}
+
+	headerSize := int(binary.LittleEndian.Uint32(data[0:]))
+	width := int(int32(binary.LittleEndian.Uint32(data[4:])))
+	height := int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+	bitCount := int(binary.LittleEndian.Uint16(data[14:]))
+	compression := binary.LittleEndian.Uint32(data[16:])
+	colorsUsed := int(binary.LittleEndian.Uint32(data[32:]))
+
+	if compression != 0 {
+		return nil, fmt.Errorf("unsupported dib compression: %d", compression)
+	}
+
+	topDown := height < 0
+
+	if topDown {
+		height = -height
+	}
+
+	if width < 1 || height < 1 || headerSize > len(data) {
+		return nil, fmt.Errorf("invalid dib dimensions: %dx%d", width, height)
+	}
+
+	palette := make(color.Palette, 0)
+	offset := headerSize
+
+	if bitCount <= 8 {
+		if colorsUsed == 0 {
+			colorsUsed = 1 << uint(bitCount)
+		}
+
+		if offset+colorsUsed*4 > len(data) {
+			return nil, errors.New("dib palette is truncated")
+		}
+
+		for i := 0; i < colorsUsed; i++ {
+			entry := data[offset+i*4:]
+
+			palette = append(palette, color.NRGBA{R: entry[2], G: entry[1], B: entry[0], A: 255})
+		}
+
+		offset += colorsUsed * 4
+	}
+
+	switch bitCount {
+	case 1, 4, 8, 24, 32:
+	default:
+		return nil, fmt.Errorf("unsupported dib bit count: %d", bitCount)
+	}
+
+	stride := (width*bitCount + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+
+	if offset+stride*height > len(data) {
+		return nil, errors.New("dib pixel data is truncated")
+	}
+
+	pixels := data[offset : offset+stride*height]
+	mask := data[offset+stride*height:]
+	hasMask := len(mask) >= maskStride*height
+	hasAlpha := false
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		row := pixels[y*stride:]
+		dy := height - 1 - y
+
+		if topDown {
+			dy = y
+		}
+
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+
+			switch bitCount {
+			case 32:
+				c = color.NRGBA{R: row[x*4+2], G: row[x*4+1], B: row[x*4], A: row[x*4+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			case 24:
+				c = color.NRGBA{R: row[x*3+2], G: row[x*3+1], B: row[x*3], A: 255}
+			default:
+				perByte := 8 / bitCount
+				shift := uint(8 - bitCount*(x%perByte+1))
+				index := int(row[x/perByte]>>shift) & (1<<uint(bitCount) - 1)
+
+				if index < len(palette) {
+					c = palette[index].(color.NRGBA)
+				}
+			}
+
+			img.SetNRGBA(x, dy, c)
+		}
+	}
+
+	if bitCount == 32 && hasAlpha {
+		return img, nil
+	}
+
+	for y := 0; y < height; y++ {
+		dy := height - 1 - y
+
+		if topDown {
+			dy = y
+		}
+
+		for x := 0; x < width; x++ {
+			transparent := hasMask && mask[y*maskStride+x/8]>>(7-uint(x%8))&1 == 1
+			offset := img.PixOffset(x, dy)
+
+			if transparent {
+				img.Pix[offset+3] = 0
+			} else {
+				img.Pix[offset+3] = 255
+			}
+		}
+	}
+
+	return img, nil
+}
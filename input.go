@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const stdinName = "-"
+
+var stdin = bufio.NewReader(os.Stdin)
+
+var (
+	downloadTimeout = 30 * time.Second
+	mimeFormats     = map[string]string{
+		"image/png":                "png",
+		"image/apng":               "png",
+		"image/jpeg":               "jpeg",
+		"image/gif":                "gif",
+		"image/webp":               "webp",
+		"image/bmp":                "bmp",
+		"image/x-ms-bmp":           "bmp",
+		"image/tiff":               "tiff",
+		"image/x-icon":             "ico",
+		"image/vnd.microsoft.icon": "ico",
+		"image/x-portable-bitmap":  "pbm",
+		"image/x-portable-graymap": "pgm",
+		"image/x-portable-pixmap":  "ppm",
+	}
+)
+
+type Input struct {
+	Name     string
+	Data     []byte
+	Declared string
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+func parseByteSize(value string) (int64, error) {
+	multiplier := int64(1)
+	number := strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(value), "B"))
+
+	if len(number) > 0 {
+		switch number[len(number)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+
+		if multiplier > 1 {
+			number = number[:len(number)-1]
+		}
+	}
+
+	size, err := strconv.ParseInt(number, 10, 64)
+
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+
+	return size * multiplier, nil
+}
+
+func displayName(name string) string {
+	if name == stdinName {
+		return "standard input"
+	}
+
+	return name
+}
+
+func inputBaseName(name string) string {
+	switch {
+	case name == stdinName:
+		return "stdin"
+	case strings.HasPrefix(name, dataURIPrefix):
+		return "data"
+	case isURL(name):
+		if parsed, err := url.Parse(name); err == nil && len(strings.Trim(parsed.Path, "/")) > 0 {
+			return path.Base(parsed.Path)
+		}
+
+		return "download"
+	}
+
+	return filepath.Base(name)
+}
+
+func readInput(name string, opts *Options) (*Input, error) {
+	if name == stdinName {
+		data, err := ioutil.ReadAll(stdin)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if isDataURI(data) {
+			return parseDataURI(string(data))
+		}
+
+		return &Input{Name: displayName(name), Data: data}, nil
+	}
+
+	if strings.HasPrefix(name, dataURIPrefix) {
+		return parseDataURI(name)
+	}
+
+	if isURL(name) {
+		return download(name, opts)
+	}
+
+	data, err := ioutil.ReadFile(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Input{Name: name, Data: data, Declared: extensionFormat(name)}, nil
+}
+
+func download(rawURL string, opts *Options) (*Input, error) {
+	limit, err := parseByteSize(opts.MaxDownload)
+
+	if err != nil {
+		return nil, fmt.Errorf("--max-download: %w", err)
+	}
+
+	parsed, err := url.Parse(rawURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: downloadTimeout}
+	resp, err := client.Get(parsed.String())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: server responded with %s", rawURL, resp.Status)
+	}
+
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("downloading %s: response is %d bytes which exceeds --max-download of %d bytes", rawURL, resp.ContentLength, limit)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", rawURL, err)
+	}
+
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("downloading %s: response exceeds --max-download of %d bytes", rawURL, limit)
+	}
+
+	if len(data) < 1 {
+		return nil, fmt.Errorf("downloading %s: response body is empty", rawURL)
+	}
+
+	declared := extensionFormat(resp.Request.URL.Path)
+
+	if len(declared) < 1 {
+		if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+			declared = mimeFormats[mediaType]
+		}
+	}
+
+	if opts.Verbose {
+		fmt.Printf("VERBOSE: Downloaded %s (%s, Content-Type '%s')\n", resp.Request.URL, resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	return &Input{Name: rawURL, Data: data, Declared: declared}, nil
+}
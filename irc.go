@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+)
+
+const ircColor = '\x03'
+
+// mircPalette holds the 16 classic mIRC colors followed by the 83 extended
+// colors (16-98) understood by most modern clients.
+var mircPalette = hexPalette(
+	0xffffff, 0x000000, 0x00007f, 0x009300, 0xff0000, 0x7f0000, 0x9c009c, 0xfc7f00,
+	0xffff00, 0x00fc00, 0x009393, 0x00ffff, 0x0000fc, 0xff00ff, 0x7f7f7f, 0xd2d2d2,
+	0x470000, 0x472100, 0x474700, 0x324700, 0x004700, 0x00472c, 0x004747, 0x002747, 0x000047, 0x2e0047, 0x470047, 0x47002a,
+	0x740000, 0x743a00, 0x747400, 0x517400, 0x007400, 0x007449, 0x007474, 0x004074, 0x000074, 0x4b0074, 0x740074, 0x740045,
+	0xb50000, 0xb56300, 0xb5b500, 0x7db500, 0x00b500, 0x00b571, 0x00b5b5, 0x0063b5, 0x0000b5, 0x7500b5, 0xb500b5, 0xb5006b,
+	0xff0000, 0xff8c00, 0xffff00, 0xb2ff00, 0x00ff00, 0x00ffa0, 0x00ffff, 0x008cff, 0x0000ff, 0xa500ff, 0xff00ff, 0xff0098,
+	0xff5959, 0xffb459, 0xffff71, 0xcfff60, 0x6fff6f, 0x65ffc9, 0x6dffff, 0x59b4ff, 0x5959ff, 0xc459ff, 0xff66ff, 0xff59bc,
+	0xff9c9c, 0xffd39c, 0xffff9c, 0xe2ff9c, 0x9cff9c, 0x9cffdb, 0x9cffff, 0x9cd3ff, 0x9c9cff, 0xdc9cff, 0xff9cff, 0xff94d3,
+	0x000000, 0x131313, 0x282828, 0x363636, 0x4d4d4d, 0x656565, 0x818181, 0x9f9f9f, 0xbcbcbc, 0xe2e2e2, 0xffffff,
+)
+
+func hexPalette(values ...uint32) []color.NRGBA {
+	palette := make([]color.NRGBA, 0, len(values))
+
+	for _, v := range values {
+		palette = append(palette, color.NRGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255})
+	}
+
+	return palette
+}
+
+// ircCode returns the code selecting the color at index ahead of char. With
+// --irc-background the cell color fills the background and the character is
+// drawn in black or white, whichever is more legible on it.
+func ircCode(index int, char rune, opts *Options) string {
+	if opts.IRCBackground {
+		fg := 1
+
+		if luminance(mircPalette[index], opts.LumaFormula) < 0.5 {
+			fg = 0
+		}
+
+		return fmt.Sprintf("%c%02d,%02d", ircColor, fg, index)
+	}
+
+	// A comma straight after a foreground-only code would be read as the
+	// start of a background color.
+	if char == ',' {
+		return fmt.Sprintf("%c%02d\x02\x02", ircColor, index)
+	}
+
+	return fmt.Sprintf("%c%02d", ircColor, index)
+}
+
+// renderIRC writes one message per row using mIRC color codes, emitting a code
+// only when the color changes. Rows longer than --irc-max-width bytes are
+// wrapped onto further lines which start with the current color again.
+func renderIRC(art Art, opts *Options) ([]byte, error) {
+	result := &bytes.Buffer{}
+	colored := colorEnabled(opts)
+	palette, labs := mircPalette[:opts.IRCColors], mircLab[:opts.IRCColors]
+
+	for y, row := range art.Cells {
+		line := &bytes.Buffer{}
+		current := -1
+
+		for _, cell := range row {
+			index := -1
+			code := ""
+
+			if colored && cell.Plain {
+				index = current
+			} else if colored {
+				index = nearestColor(displayColor(cell, opts), palette, labs, opts.Match)
+			}
+
+			if index != current {
+				code = ircCode(index, cell.Char, opts)
+			}
+
+			char := string(cell.Char)
+
+			if opts.IRCMaxWidth > 0 && line.Len() > 0 && line.Len()+len(code)+len(char) > opts.IRCMaxWidth {
+				result.Write(line.Bytes())
+				result.WriteString("\n")
+				line.Reset()
+
+				if colored {
+					code = ircCode(index, cell.Char, opts)
+				}
+			}
+
+			line.WriteString(code)
+			line.WriteString(char)
+
+			current = index
+		}
+
+		result.Write(line.Bytes())
+
+		if y+1 != len(art.Cells) {
+			result.WriteString("\n")
+		}
+	}
+
+	return result.Bytes(), nil
+}
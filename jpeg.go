@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+)
+
+type jpegInfo struct {
+	Components          int
+	AdobeTransform      int
+	AdobeTransformValid bool
+	Orientation         int
+}
+
+func readJPEGInfo(data []byte) *jpegInfo {
+	info := &jpegInfo{}
+
+	for offset := 2; offset+4 <= len(data); {
+		if data[offset] != 0xff {
+			break
+		}
+
+		marker := data[offset+1]
+
+		if marker == 0xff {
+			offset++
+
+			continue
+		}
+
+		if marker == 0xd8 || (marker >= 0xd0 && marker <= 0xd7) || marker == 0x01 {
+			offset += 2
+
+			continue
+		}
+
+		length := int(data[offset+2])<<8 | int(data[offset+3])
+		segment := data[offset+4:]
+
+		if length < 2 || offset+2+length > len(data) {
+			break
+		}
+
+		segment = segment[:length-2]
+
+		switch {
+		case marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc:
+			if len(segment) >= 6 {
+				info.Components = int(segment[5])
+			}
+		case marker == 0xee:
+			if len(segment) >= 12 && bytes.HasPrefix(segment, []byte("Adobe")) {
+				info.AdobeTransform = int(segment[11])
+				info.AdobeTransformValid = true
+			}
+		case marker == 0xe1:
+			if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) && info.Orientation == 0 {
+				info.Orientation = exifOrientation(segment[6:])
+			}
+		case marker == 0xda:
+			return info
+		}
+
+		offset += 2 + length
+	}
+
+	return info
+}
+
+func (info *jpegInfo) ColorModel() string {
+	switch info.Components {
+	case 1:
+		return "grayscale"
+	case 3:
+		if info.AdobeTransformValid && info.AdobeTransform == 0 {
+			return "RGB"
+		}
+
+		return "YCbCr"
+	case 4:
+		if !info.AdobeTransformValid || info.AdobeTransform == 0 {
+			return "CMYK"
+		}
+
+		return "YCCK"
+	}
+
+	return "unknown"
+}
+
+// decodeCMYKJPEG decodes a 4-component JPEG without Adobe APP14 metadata,
+// which image/jpeg refuses. Such files store plain (non-inverted) CMYK, so an
+// APP14 segment marking the data as CMYK is inserted and the inversion the
+// decoder then applies is undone.
+func decodeCMYKJPEG(data []byte) (image.Image, error) {
+	app14 := []byte{0xff, 0xee, 0x00, 0x0e, 'A', 'd', 'o', 'b', 'e', 0x00, 0x64, 0x00, 0x00, 0x00, 0x00, 0x00}
+	patched := make([]byte, 0, len(data)+len(app14))
+
+	patched = append(patched, data[:2]...)
+	patched = append(patched, app14...)
+	patched = append(patched, data[2:]...)
+
+	img, err := jpeg.Decode(bytes.NewReader(patched))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cmyk, ok := img.(*image.CMYK); ok {
+		for i := range cmyk.Pix {
+			cmyk.Pix[i] = 255 - cmyk.Pix[i]
+		}
+	}
+
+	return img, nil
+}
+
+func cmykToRGBA(img *image.CMYK) *image.RGBA {
+	output := image.NewRGBA(img.Bounds())
+
+	draw.Draw(output, output.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	return output
+}
+
+func exifOrientation(data []byte) int {
+	order, err := tiffByteOrder(data)
+
+	if err != nil {
+		return 0
+	}
+
+	offset := int(order.Uint32(data[4:]))
+
+	if offset < 8 || offset+2 > len(data) {
+		return 0
+	}
+
+	entries := int(order.Uint16(data[offset:]))
+
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+
+		if entry+12 > len(data) {
+			return 0
+		}
+
+		if order.Uint16(data[entry:]) == 0x0112 {
+			value := int(order.Uint16(data[entry+8:]))
+
+			if value < 1 || value > 8 {
+				return 0
+			}
+
+			return value
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+// The fixtures are from the Go image testdata: the CMYK JPEG and the RGB PNG
+// the standard library checks its decoding of it against.
+func TestDecodeCMYKJPEG(t *testing.T) {
+	cmyk, err := os.ReadFile("testdata/video-001.cmyk.jpeg")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reference, err := os.ReadFile("testdata/video-001.cmyk.png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if model := readJPEGInfo(cmyk).ColorModel(); model != "CMYK" {
+		t.Fatalf("ColorModel = %q, want CMYK", model)
+	}
+
+	got := convertData(t, cmyk, "-r", "40x12")
+	want := convertData(t, reference, "-r", "40x12")
+
+	if len(got.Cells) != len(want.Cells) || len(got.Cells[0]) != len(want.Cells[0]) {
+		t.Fatalf("art is %dx%d, want %dx%d", len(got.Cells[0]), len(got.Cells), len(want.Cells[0]), len(want.Cells))
+	}
+
+	var difference, inverted float64
+	count := 0
+
+	for y, row := range want.Cells {
+		for x, cell := range row {
+			difference += math.Abs(got.Cells[y][x].Lum - cell.Lum)
+			inverted += math.Abs(1 - got.Cells[y][x].Lum - cell.Lum)
+			count++
+		}
+	}
+
+	difference /= float64(count)
+	inverted /= float64(count)
+
+	if difference > 0.02 {
+		t.Errorf("mean luminance difference from the reference is %.3f, want at most 0.02", difference)
+	}
+
+	if inverted < 10*difference {
+		t.Errorf("mean luminance difference from the inverted reference is %.3f, want far more than %.3f", inverted, difference)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// JSONArt is the document written by --format=json. Cells are row-major.
+type JSONArt struct {
+	Width      int          `json:"width"`
+	Height     int          `json:"height"`
+	Charset    string       `json:"charset"`
+	Characters string       `json:"characters"`
+	Cells      [][]JSONCell `json:"cells"`
+}
+
+type JSONCell struct {
+	Char      string   `json:"char"`
+	Luminance float64  `json:"luminance"`
+	RGB       [3]uint8 `json:"rgb"`
+}
+
+// JSONCompactArt is the document written by --format=json --json-compact.
+// Colors holds one "#rrggbb" entry for every character of the matching row.
+type JSONCompactArt struct {
+	Width      int        `json:"width"`
+	Height     int        `json:"height"`
+	Charset    string     `json:"charset"`
+	Characters string     `json:"characters"`
+	Rows       []string   `json:"rows"`
+	Colors     [][]string `json:"colors"`
+}
+
+func renderJSON(art Art, opts *Options) ([]byte, error) {
+	if opts.JSONCompact {
+		result := JSONCompactArt{
+			Width:      artWidth(art),
+			Height:     len(art.Cells),
+			Charset:    charsetName(opts),
+			Characters: art.Charset,
+			Rows:       make([]string, 0, len(art.Cells)),
+			Colors:     make([][]string, 0, len(art.Cells)),
+		}
+
+		for _, row := range art.Cells {
+			chars := make([]rune, 0, len(row))
+			colors := make([]string, 0, len(row))
+
+			for _, cell := range row {
+				chars = append(chars, cell.Char)
+				colors = append(colors, hexColor(cell.Color))
+			}
+
+			result.Rows = append(result.Rows, string(chars))
+			result.Colors = append(result.Colors, colors)
+		}
+
+		return encodeJSON(result, "")
+	}
+
+	result := JSONArt{
+		Width:      artWidth(art),
+		Height:     len(art.Cells),
+		Charset:    charsetName(opts),
+		Characters: art.Charset,
+		Cells:      make([][]JSONCell, 0, len(art.Cells)),
+	}
+
+	for _, row := range art.Cells {
+		cells := make([]JSONCell, 0, len(row))
+
+		for _, cell := range row {
+			cells = append(cells, JSONCell{
+				Char:      string(cell.Char),
+				Luminance: cell.Lum,
+				RGB:       [3]uint8{cell.Color.R, cell.Color.G, cell.Color.B},
+			})
+		}
+
+		result.Cells = append(result.Cells, cells)
+	}
+
+	return encodeJSON(result, "  ")
+}
+
+func encodeJSON(v interface{}, indent string) ([]byte, error) {
+	result := &bytes.Buffer{}
+	encoder := json.NewEncoder(result)
+
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return result.Bytes(), nil
+}
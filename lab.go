@@ -0,0 +1,126 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"sync"
+)
+
+// labColor is a color in CIE L*a*b*, where the distance between two colors
+// follows how different they look.
+type labColor struct {
+	L, A, B float64
+}
+
+var (
+	ansi16Lab = labPalette(ansi16Palette)
+	mircLab   = labPalette(mircPalette)
+
+	ansi256LabOnce sync.Once
+	ansi256Lab     [256]labColor
+)
+
+// labPalette converts every color of a palette to L*a*b* up front, so that
+// matching against it only has to convert the color being matched.
+func labPalette(palette []color.NRGBA) []labColor {
+	labs := make([]labColor, len(palette))
+
+	for i, entry := range palette {
+		labs[i] = toLab(entry)
+	}
+
+	return labs
+}
+
+// toLab converts an sRGB color to L*a*b* under the D65 white point.
+func toLab(c color.NRGBA) labColor {
+	linear := func(v uint8) float64 {
+		s := float64(v) / 255
+
+		if s <= 0.04045 {
+			return s / 12.92
+		}
+
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+
+	r, g, b := linear(c.R), linear(c.G), linear(c.B)
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*b
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+
+		return (24389.0/27*t + 16) / 116
+	}
+
+	fx, fy, fz := f(x), f(y), f(z)
+
+	return labColor{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// fromLab converts an L*a*b* color back to sRGB, clipping colors outside it.
+func fromLab(c labColor) color.NRGBA {
+	f := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+
+		return (116*t - 16) * 27 / 24389
+	}
+
+	fy := (c.L + 16) / 116
+	x, y, z := f(fy+c.A/500)*0.95047, f(fy), f(fy-c.B/200)*1.08883
+	channel := func(v float64) uint8 {
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+
+		return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+
+	return color.NRGBA{
+		channel(3.2406*x - 1.5372*y - 0.4986*z),
+		channel(-0.9689*x + 1.8758*y + 0.0415*z),
+		channel(0.0557*x - 0.2040*y + 1.0570*z),
+		255,
+	}
+}
+
+// labDistance is the squared CIE76 color difference.
+func labDistance(a, b labColor) float64 {
+	dl, da, db := a.L-b.L, a.A-b.A, a.B-b.B
+
+	return dl*dl + da*da + db*db
+}
+
+// nearestLab returns the index of the palette color closest to c in L*a*b*.
+func nearestLab(c color.NRGBA, palette []labColor, start int) int {
+	target := toLab(c)
+	best, bestDistance := start, math.Inf(1)
+
+	for i := start; i < len(palette); i++ {
+		if distance := labDistance(target, palette[i]); distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+
+	return best
+}
+
+// nearestANSI256Lab matches a color against the cube and gray ramp of the
+// 256-color palette in L*a*b*, leaving out the first 16 colors, which
+// terminals define themselves.
+func nearestANSI256Lab(c color.NRGBA) int {
+	ansi256LabOnce.Do(func() {
+		for i := range ansi256Lab {
+			ansi256Lab[i] = toLab(ansi256Color(i))
+		}
+	})
+
+	return nearestLab(c, ansi256Lab[:], 16)
+}
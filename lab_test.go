@@ -0,0 +1,39 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestMatchLabHueWheel(t *testing.T) {
+	var wheel []color.NRGBA
+
+	for h := 0; h < 360; h += 5 {
+		for _, s := range []float64{0.5, 1} {
+			for _, l := range []float64{0.25, 0.5, 0.75} {
+				wheel = append(wheel, fromHSL(float64(h), s, l, 255))
+			}
+		}
+	}
+
+	for _, mode := range []string{"ansi16", "ansi256"} {
+		t.Run(mode, func(t *testing.T) {
+			var mean [2]float64
+
+			for i, match := range []string{"rgb", "lab"} {
+				opts := testOptions(t, "--color", mode, "--match", match)
+
+				for _, c := range wheel {
+					mean[i] += math.Sqrt(labDistance(toLab(c), toLab(paletteColor(c, 0, opts)))) / float64(len(wheel))
+				}
+			}
+
+			if mean[1] > 0.9*mean[0] {
+				t.Errorf("mean ΔE is %.2f with lab, want at least 10%% below the %.2f with rgb", mean[1], mean[0])
+			}
+
+			t.Logf("mean ΔE is %.2f with rgb and %.2f with lab", mean[0], mean[1])
+		})
+	}
+}
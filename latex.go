@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// escapeLaTeX escapes a character for environments where \, { and } keep
+// their meaning, using character codes so the tt font shows the real glyph.
+func escapeLaTeX(r rune) string {
+	switch r {
+	case '\\':
+		return "{\\char92}"
+	case '{':
+		return "{\\char123}"
+	case '}':
+		return "{\\char125}"
+	case '`':
+		return "{`}"
+	}
+
+	return string(r)
+}
+
+func latexEnvironment(opts *Options) (string, error) {
+	switch opts.LaTeXEnvironment {
+	case "auto":
+		if colorEnabled(opts) {
+			return "alltt", nil
+		}
+
+		return "verbatim", nil
+	case "verbatim":
+		if colorEnabled(opts) {
+			return "", fmt.Errorf("the verbatim environment cannot show color, use --latex-environment=alltt or fancyvrb")
+		}
+	}
+
+	return opts.LaTeXEnvironment, nil
+}
+
+func renderLaTeX(art Art, opts *Options) ([]byte, error) {
+	environment, err := latexEnvironment(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &bytes.Buffer{}
+	colored := colorEnabled(opts)
+
+	switch environment {
+	case "alltt":
+		result.WriteString("% Requires \\usepackage{alltt}")
+
+		if colored {
+			result.WriteString(" and \\usepackage{xcolor}")
+		}
+
+		result.WriteString("\n")
+	case "fancyvrb":
+		result.WriteString("% Requires \\usepackage{fancyvrb}")
+
+		if colored {
+			result.WriteString(" and \\usepackage{xcolor}")
+		}
+
+		result.WriteString("\n")
+	}
+
+	if environment == "fancyvrb" {
+		fmt.Fprintf(result, "\\begin{Verbatim}[fontsize=\\%s,commandchars=\\\\\\{\\}]\n", opts.LaTeXFontSize)
+	} else {
+		fmt.Fprintf(result, "\\begingroup\\%s\n\\begin{%s}\n", opts.LaTeXFontSize, environment)
+	}
+
+	for _, row := range art.Cells {
+		line := &strings.Builder{}
+
+		for x := 0; x < len(row); {
+			c := displayColor(row[x], opts)
+			run := &strings.Builder{}
+
+			for ; x < len(row) && (!colored || displayColor(row[x], opts) == c); x++ {
+				if environment == "verbatim" {
+					run.WriteRune(row[x].Char)
+				} else {
+					run.WriteString(escapeLaTeX(row[x].Char))
+				}
+			}
+
+			if colored {
+				fmt.Fprintf(line, "\\textcolor[RGB]{%d,%d,%d}{%s}", c.R, c.G, c.B, run.String())
+			} else {
+				line.WriteString(run.String())
+			}
+		}
+
+		if environment == "verbatim" && strings.Contains(line.String(), "\\end{verbatim}") {
+			return nil, fmt.Errorf("the art contains \\end{verbatim}, use --latex-environment=alltt or fancyvrb")
+		}
+
+		result.WriteString(line.String())
+		result.WriteString("\n")
+	}
+
+	if environment == "fancyvrb" {
+		result.WriteString("\\end{Verbatim}\n")
+	} else {
+		fmt.Fprintf(result, "\\end{%s}\n\\endgroup\n", environment)
+	}
+
+	return result.Bytes(), nil
+}
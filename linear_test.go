@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// averageLum returns the mean luminance of the cells of the art.
+func averageLum(art Art) float64 {
+	total, count := 0.0, 0
+
+	for _, row := range art.Cells {
+		for _, cell := range row {
+			total += cell.Lum
+			count++
+		}
+	}
+
+	return total / float64(count)
+}
+
+func TestLinearResizeCheckerboard(t *testing.T) {
+	// Half the pixels give off all the light, so the checkerboard is as
+	// bright as a 50% linear gray, which is about 73.5% in sRGB.
+	img := grayImage(100, 100, func(x, y int) uint8 { return uint8((x + y) % 2 * 255) })
+	want := 1.055*math.Pow(0.5, 1/2.4) - 0.055
+
+	for _, filter := range []string{"area", "bilinear", "bicubic", "lanczos"} {
+		t.Run(filter, func(t *testing.T) {
+			if lum := averageLum(convertImage(t, img, "-r", "10x10", "--filter", filter, "--linear-resize")); math.Abs(lum-want) > 0.02 {
+				t.Errorf("average luminance with --linear-resize is %.3f, want %.3f", lum, want)
+			}
+		})
+	}
+
+	// Averaging sRGB values dims it to 50%.
+	if lum := averageLum(convertImage(t, img, "-r", "10x10", "--filter", "area")); math.Abs(lum-0.5) > 0.02 {
+		t.Errorf("average luminance without --linear-resize is %.3f, want 0.5", lum)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+)
+
+// binaryFormats are written byte for byte. The ans format applies the line
+// ending options itself as its SAUCE record is binary.
+var binaryFormats = map[string]bool{
+	"png": true,
+	"pdf": true,
+	"ans": true,
+}
+
+func lineEnding(opts *Options, fallback string) string {
+	switch opts.LineEnding {
+	case "lf":
+		return "\n"
+	case "crlf":
+		return "\r\n"
+	case "native":
+		if runtime.GOOS == "windows" {
+			return "\r\n"
+		}
+
+		return "\n"
+	}
+
+	return fallback
+}
+
+// lineEndingWriter replaces every LF that is not already part of a CRLF.
+type lineEndingWriter struct {
+	w      io.Writer
+	ending []byte
+	lastCR bool
+}
+
+func (w *lineEndingWriter) Write(p []byte) (int, error) {
+	result := make([]byte, 0, len(p))
+
+	for _, b := range p {
+		if b == '\n' && !w.lastCR {
+			result = append(result, w.ending...)
+		} else {
+			result = append(result, b)
+		}
+
+		w.lastCR = b == '\r'
+	}
+
+	if _, err := w.w.Write(result); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func newOutputWriter(w io.Writer, opts *Options) io.Writer {
+	ending := lineEnding(opts, "\n")
+
+	if binaryFormats[opts.Format] || ending == "\n" {
+		return w
+	}
+
+	return &lineEndingWriter{w: w, ending: []byte(ending)}
+}
+
+// applyFinalNewline adds or removes the newline at the end of an output as
+// --final-newline asks, leaving the output as rendered by default.
+func applyFinalNewline(output []byte, opts *Options) []byte {
+	if binaryFormats[opts.Format] {
+		return output
+	}
+
+	switch opts.FinalNewline {
+	case "true":
+		if !bytes.HasSuffix(output, []byte("\n")) {
+			return append(output, '\n')
+		}
+	case "false":
+		return bytes.TrimSuffix(bytes.TrimSuffix(output, []byte("\n")), []byte("\r"))
+	}
+
+	return output
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// escapeSequence matches a complete SGR escape sequence.
+var escapeSequence = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// renderLineEndings converts a colorful image with the arguments and renders
+// it through the output writer as a file would be written.
+func renderLineEndings(t *testing.T, args ...string) string {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 6, 3))
+
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 6; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 50), uint8(y * 120), 200, 255})
+		}
+	}
+
+	opts := testOptions(t, args...)
+	art := convertImage(t, img, args...)
+	outputs, err := renderArts([]Art{art}, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &bytes.Buffer{}
+
+	if _, err := newOutputWriter(result, opts).Write(applyFinalNewline(outputs[0], opts)); err != nil {
+		t.Fatal(err)
+	}
+
+	return result.String()
+}
+
+func TestLineEndingColored(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		args    []string
+		ending  string
+		newline bool
+	}{
+		{"lf", []string{"--line-ending", "lf"}, "\n", false},
+		{"lf with final newline", []string{"--line-ending", "lf", "--final-newline", "true"}, "\n", true},
+		{"crlf", []string{"--line-ending", "crlf"}, "\r\n", false},
+		{"crlf with final newline", []string{"--line-ending", "crlf", "--final-newline", "true"}, "\r\n", true},
+	} {
+		for _, mode := range []string{"ansi16", "ansi256", "truecolor"} {
+			t.Run(test.name+"/"+mode, func(t *testing.T) {
+				args := append([]string{"-r", "6x3", "--color", mode}, test.args...)
+				output := renderLineEndings(t, args...)
+
+				if newline := strings.HasSuffix(output, test.ending); newline != test.newline {
+					t.Fatalf("output ends with a line ending = %t, want %t: %q", newline, test.newline, output)
+				}
+
+				lines := strings.Split(strings.TrimSuffix(output, test.ending), test.ending)
+
+				if len(lines) != 3 {
+					t.Fatalf("output has %d lines, want 3: %q", len(lines), output)
+				}
+
+				for i, line := range lines {
+					if strings.ContainsAny(line, "\r\n") {
+						t.Errorf("line %d has a stray line ending: %q", i, line)
+					}
+
+					if rest := escapeSequence.ReplaceAllString(line, ""); strings.ContainsRune(rest, '\x1b') {
+						t.Errorf("line %d has a split escape sequence: %q", i, line)
+					}
+
+					if !strings.HasSuffix(line, "\x1b[0m") {
+						t.Errorf("line %d does not reset its color before the line ending: %q", i, line)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestLineEndingWriterSplitCRLF(t *testing.T) {
+	result := &bytes.Buffer{}
+	w := &lineEndingWriter{w: result, ending: []byte("\r\n")}
+
+	for _, chunk := range []string{"a\n", "b\r", "\nc\n"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := "a\r\nb\r\nc\r\n"; result.String() != want {
+		t.Errorf("output = %q, want %q", result.String(), want)
+	}
+}
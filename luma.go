@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// lumaFormula weighs the red, green and blue of a color, each 0 to 1, into
+// its luminance.
+type lumaFormula func(r, g, b float64) float64
+
+func lumaWeights(r, g, b float64) lumaFormula {
+	return func(red, green, blue float64) float64 { return r*red + g*green + b*blue }
+}
+
+var lumaFormulas = map[string]lumaFormula{
+	"601":       lumaWeights(0.299, 0.587, 0.114),
+	"709":       lumaWeights(0.2126, 0.7152, 0.0722),
+	"2020":      lumaWeights(0.2627, 0.678, 0.0593),
+	"average":   lumaWeights(1.0/3, 1.0/3, 1.0/3),
+	"lightness": func(r, g, b float64) float64 { return (math.Max(r, math.Max(g, b)) + math.Min(r, math.Min(g, b))) / 2 },
+	"value":     func(r, g, b float64) float64 { return math.Max(r, math.Max(g, b)) },
+}
+
+// checkLuma selects the --luma formula.
+func checkLuma(opts *Options) error {
+	formula, ok := lumaFormulas[opts.Luma]
+
+	if !ok {
+		return fmt.Errorf("invalid --luma: %s", opts.Luma)
+	}
+
+	if opts.Colorimetric {
+		formula = colorimetric(formula)
+	}
+
+	opts.LumaFormula = formula
+
+	return nil
+}
+
+// colorimetric applies the formula to the channels in linear light, as the
+// eye adds up light, and encodes the result back to sRGB for the character
+// set. The weights of sRGB itself are the Rec. 709 ones.
+func colorimetric(formula lumaFormula) lumaFormula {
+	srgbOnce.Do(buildSRGBTables)
+
+	linear := func(v float64) float64 {
+		return float64(srgbToLinear[uint16(math.Round(v*math.MaxUint16))]) / math.MaxUint16
+	}
+
+	return func(r, g, b float64) float64 {
+		y := math.Max(0, math.Min(1, formula(linear(r), linear(g), linear(b))))
+
+		return float64(linearToSRGB[uint16(math.Round(y*math.MaxUint16))]) / math.MaxUint16
+	}
+}
+
+// luminance weighs a color with the formula, or the Rec. 601 one when it is
+// nil.
+func luminance(color color.Color, formula lumaFormula) float64 {
+	if formula == nil {
+		formula = lumaFormulas["601"]
+	}
+
+	r, g, b, _ := color.RGBA()
+
+	return formula(float64(r)/math.MaxUint16, float64(g)/math.MaxUint16, float64(b)/math.MaxUint16)
+}
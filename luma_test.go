@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrites the golden files in testdata")
+
+// colorChart is one pixel of each of the primaries, secondaries, grays and a
+// few mixed colors.
+var colorChart = []color.NRGBA{
+	{0, 0, 0, 255},
+	{255, 255, 255, 255},
+	{128, 128, 128, 255},
+	{255, 0, 0, 255},
+	{0, 255, 0, 255},
+	{0, 0, 255, 255},
+	{0, 255, 255, 255},
+	{255, 0, 255, 255},
+	{255, 255, 0, 255},
+	{255, 128, 0, 255},
+	{64, 160, 96, 255},
+	{40, 60, 200, 255},
+}
+
+// colorChartImage returns the chart as an image one pixel tall.
+func colorChartImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, len(colorChart), 1))
+
+	for x, c := range colorChart {
+		img.SetNRGBA(x, 0, c)
+	}
+
+	return img
+}
+
+// checkGolden compares the output with the golden file, or rewrites it with
+// -update.
+func checkGolden(t *testing.T, path string, output []byte) {
+	t.Helper()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, output, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	want, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("%s (run go test -update to create it)", err)
+	}
+
+	if !bytes.Equal(output, want) {
+		t.Errorf("output differs from %s:\n%s\nwant:\n%s", path, output, want)
+	}
+}
+
+func TestLumaGolden(t *testing.T) {
+	for _, name := range []string{"601", "709", "2020", "average", "lightness", "value"} {
+		t.Run(name, func(t *testing.T) {
+			art := convertImage(t, colorChartImage(), "-r", fmt.Sprintf("%dx1", len(colorChart)), "--luma", name)
+			output := &bytes.Buffer{}
+
+			for x, cell := range art.Cells[0] {
+				c := colorChart[x]
+
+				fmt.Fprintf(output, "#%02x%02x%02x %.6f %c\n", c.R, c.G, c.B, cell.Lum, cell.Char)
+			}
+
+			checkGolden(t, filepath.Join("testdata", "luma", name+".golden"), output.Bytes())
+		})
+	}
+}
+
+func TestColorimetric(t *testing.T) {
+	size := fmt.Sprintf("%dx1", len(colorChart))
+	plain := convertImage(t, colorChartImage(), "-r", size, "--luma", "709")
+	art := convertImage(t, colorChartImage(), "-r", size, "--luma", "709", "--colorimetric")
+	output := &bytes.Buffer{}
+
+	for x, cell := range art.Cells[0] {
+		c := colorChart[x]
+		r, g, b := srgbDecode(float64(c.R)/255), srgbDecode(float64(c.G)/255), srgbDecode(float64(c.B)/255)
+		want := srgbEncode(0.2126*r + 0.7152*g + 0.0722*b)
+
+		if math.Abs(cell.Lum-want) > 0.001 {
+			t.Errorf("luminance of #%02x%02x%02x is %.4f, want the relative luminance %.4f", c.R, c.G, c.B, cell.Lum, want)
+		}
+
+		// Grays are as bright either way, while the weights applied to sRGB
+		// make saturated colors too dark.
+		if gray := c.R == c.G && c.G == c.B; gray && math.Abs(cell.Lum-plain.Cells[0][x].Lum) > 0.001 {
+			t.Errorf("gray #%02x%02x%02x changed from %.4f to %.4f", c.R, c.G, c.B, plain.Cells[0][x].Lum, cell.Lum)
+		} else if !gray && cell.Lum <= plain.Cells[0][x].Lum {
+			t.Errorf("#%02x%02x%02x is %.4f, want brighter than %.4f", c.R, c.G, c.B, cell.Lum, plain.Cells[0][x].Lum)
+		}
+
+		fmt.Fprintf(output, "#%02x%02x%02x %.6f %c\n", c.R, c.G, c.B, cell.Lum, cell.Char)
+	}
+
+	checkGolden(t, filepath.Join("testdata", "luma", "709-colorimetric.golden"), output.Bytes())
+}
+
+// srgbDecode converts an sRGB value to linear light.
+func srgbDecode(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// srgbEncode converts a linear light value to sRGB.
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
@@ -1,209 +1,812 @@
 package main
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
-	"image/jpeg"
-	"image/png"
-	"io/ioutil"
 	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 )
 
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 var (
 	ErrNoInput      = errors.New("missing input image argument")
 	ChararacterSets = map[string]string{
-		"ascii": ".'`^\",:;Il!i><~+_-?][}{1)(|\\/tfjrxnuvczXYUJCLQ0OZmwqpdbkhao*#MW&8%B@$",
+		"ascii":    ".'`^\",:;Il!i><~+_-?][}{1)(|\\/tfjrxnuvczXYUJCLQ0OZmwqpdbkhao*#MW&8%B@$",
+		"standard": " .:-=+*#%@",
+		"blocks":   " ░▒▓█",
+		"binary":   " █",
+		"dots":     " ⠁⠃⠇⡇⣇⣧⣷⣿",
 	}
 )
 
+type Cell struct {
+	// Background is the color behind the character, or nil for the default.
+	Background *color.NRGBA
+	Char       rune
+	Color      color.NRGBA
+	Lum        float64
+	// Plain marks filler, such as --canvas padding, written without color.
+	Plain bool
+}
+
+type Art struct {
+	Source     string
+	SourceSize image.Point
+	Charset    string
+	Cells      [][]Cell
+	Delay      time.Duration
+}
+
 type Options struct {
-	Verbose bool    `short:"V" long:"verbose" description:"Prints additional debug information"`
-	Output  string  `short:"o" long:"out" description:"The file to write the output to"`
-	Resize  string  `short:"r" long:"resize" description:"Resize the image to specific dimensions"`
-	Charset string  `short:"c" long:"charset" description:"The character set to use for the output" default:"ascii"`
-	Scale   float64 `short:"s" long:"scale" description:"Scales image and preserves aspect ratio" default:"0"`
+	Verbose              bool        `short:"V" long:"verbose" description:"Prints additional debug information"`
+	Outputs              []string    `short:"o" long:"out" description:"The file to write the output to, or - for standard output; repeat or separate with commas to write several formats at once"`
+	Output               string      `no-flag:"true"`
+	Save                 bool        `long:"save" description:"Writes the output next to each input, named after it with the extension of the format"`
+	Resize               string      `short:"r" long:"resize" description:"Resize the image to WIDTHxHEIGHT characters; leave out either side to keep the proportions"`
+	ResizeMode           string      `long:"resize-mode" description:"How -r treats sizes of other proportions than the image" choice:"stretch" choice:"fit" choice:"fill" choice:"pad" default:"stretch"`
+	Crop                 string      `long:"crop" description:"Crops the image to WxH+X+Y before resizing; negative offsets count from the right and bottom"`
+	CropClamp            bool        `long:"crop-clamp" description:"Clamps a --crop reaching outside the image instead of failing"`
+	Rotate               string      `long:"rotate" description:"Rotates the image clockwise by this many degrees" choice:"0" choice:"90" choice:"180" choice:"270" default:"0"`
+	Flip                 string      `long:"flip" description:"Flips the image horizontally or vertically, after --rotate" choice:"h" choice:"v"`
+	TrimBorder           bool        `long:"trim-border" description:"Crops away uniform margins the color of the top left corner"`
+	TrimTolerance        float64     `long:"trim-tolerance" description:"How far from 0 to 1 margin pixels may differ from the corner color" default:"0.05"`
+	Charset              string      `short:"c" long:"charset" description:"The character set to use for the output, or @path to read the ramp from the first line of a file" default:"ascii"`
+	CharsetString        string      `long:"charset-string" description:"Uses these characters as the luminance ramp, darkest first, instead of --charset"`
+	CharsetFile          string      `long:"charset-file" description:"Reads named character sets from a file of name=ramp lines, to be selected with --charset"`
+	InvertCharset        bool        `long:"invert-charset" description:"Reverses the character set, for dark text on a light background"`
+	SpaceBright          bool        `long:"space-bright" description:"Draws the brightest areas as spaces, whatever the character set"`
+	Trim                 bool        `long:"trim" description:"Removes the whitespace at the end of every line"`
+	ListCharsets         bool        `long:"list-charsets" description:"Lists the character sets with a preview of each, like the charsets command"`
+	CalibrateFont        string      `long:"calibrate-font" description:"Orders the character set by how dark each glyph renders in this TrueType or OpenType font"`
+	CalibrateLevels      int         `long:"calibrate-levels" description:"Thins a calibrated character set to this many evenly spaced glyphs"`
+	Scale                float64     `short:"s" long:"scale" description:"Scales image and preserves aspect ratio" default:"0"`
+	Fit                  bool        `long:"fit" description:"Resizes the art to fill the terminal, keeping its proportions"`
+	FitWidth             int         `long:"fit-width" description:"The width --fit uses when standard output is not a terminal" default:"80"`
+	FitBox               image.Point `no-flag:"true"`
+	CellAspect           float64     `long:"cell-aspect" description:"The width of a terminal cell divided by its height, used to keep proportions with --scale and --fit" default:"0.5"`
+	MaxWidth             int         `long:"max-width" description:"Shrinks the art to at most this many columns, keeping its proportions"`
+	MaxHeight            int         `long:"max-height" description:"Shrinks the art to at most this many rows, keeping its proportions"`
+	MaxCells             int         `long:"max-cells" description:"Refuses art of more than this many characters" default:"25000000"`
+	ForceLarge           bool        `long:"force-large" description:"Converts art larger than --max-cells anyway"`
+	Cols                 int         `long:"cols" description:"Makes the art this many characters wide, deriving the height unless --rows is given"`
+	Rows                 int         `long:"rows" description:"Makes the art this many lines tall, deriving the width unless --cols is given"`
+	Canvas               string      `long:"canvas" description:"Fits the art into COLSxROWS and pads it to exactly that size"`
+	CanvasFill           string      `long:"canvas-fill" description:"The character --canvas pads with" default:" "`
+	Gravity              string      `long:"gravity" description:"Where padded art is placed: center, top, bottom, left, right, top-left, ..." default:"center"`
+	CanvasSize           image.Point `no-flag:"true"`
+	Filter               string      `long:"filter" description:"How pixels are sampled when resizing: auto, nearest, bilinear, bicubic, lanczos or area" default:"auto"`
+	LinearResize         bool        `long:"linear-resize" description:"Mixes pixels in linear light when resizing, which keeps bright detail bright"`
+	Sample               string      `long:"sample" description:"Samples every cell of the source directly with its mean, median, max or min instead of resizing"`
+	Sharpen              float64     `long:"sharpen" description:"Sharpens the resized image by this amount, 1 for a moderate unsharp mask"`
+	Blur                 float64     `long:"blur" description:"Blurs the resized image with a Gaussian of this radius in pixels"`
+	Denoise              int         `long:"denoise" description:"Removes specks with a median filter of this radius in pixels"`
+	Background           string      `long:"background" description:"The color transparent pixels are composited over" default:"#000000"`
+	BackgroundColor      color.NRGBA `no-flag:"true"`
+	Transparent          string      `long:"transparent" description:"Whether transparent pixels are composited over --background or left blank" choice:"composite" choice:"blank" default:"composite"`
+	TransparentThreshold float64     `long:"transparent-threshold" description:"The alpha from 0 to 1 below which --transparent=blank leaves a cell blank" default:"0.5"`
+	Luma                 string      `long:"luma" description:"How colors are weighed into luminance: 601, 709, 2020, average, lightness or value" default:"601"`
+	Colorimetric         bool        `long:"colorimetric" description:"Weighs the colors into luminance in linear light, as the eye sees them"`
+	LumaFormula          lumaFormula `no-flag:"true"`
+	AutoContrast         bool        `long:"auto-contrast" description:"Stretches the tones of the image over the full range"`
+	AutoContrastLow      float64     `long:"auto-contrast-low" description:"Percentile of the pixels --auto-contrast makes black" default:"1"`
+	AutoContrastHigh     float64     `long:"auto-contrast-high" description:"Percentile of the pixels --auto-contrast makes white" default:"99"`
+	Equalize             bool        `long:"equalize" description:"Spreads the tones of the image evenly so every character is used"`
+	CLAHE                bool        `long:"clahe" description:"Equalizes each part of the image on its own, for local contrast"`
+	CLAHETiles           string      `long:"clahe-tiles" description:"Grid of COLSxROWS tiles --clahe equalizes" default:"8x8"`
+	CLAHEClip            float64     `long:"clahe-clip" description:"How far --clahe may stretch the tones of a tile, 1 for not at all" default:"2"`
+	CLAHEGrid            image.Point `no-flag:"true"`
+	Gamma                float64     `long:"gamma" description:"Brightens the image above 1 and darkens it below 1" default:"1"`
+	Brightness           float64     `long:"brightness" description:"Adds -1 to 1 to the brightness of the image"`
+	Contrast             float64     `long:"contrast" description:"Multiplies the contrast of the image around middle gray" default:"1"`
+	Levels               string      `long:"levels" description:"Stretches LOW,HIGH[,GAMMA] to black and white, 0 to 1 or 0 to 255"`
+	LevelsRange          *toneLevels `no-flag:"true"`
+	Negative             bool        `long:"negative" description:"Inverts the colors of the image, unlike --invert-charset"`
+	Dither               string      `long:"dither" description:"Mixes neighbouring characters for tones between them: none, floyd-steinberg or ordered" default:"none"`
+	DitherSerpentine     bool        `long:"dither-serpentine" description:"Dithers every other row right to left"`
+	DitherStrength       float64     `long:"dither-strength" description:"Amplitude of --dither=ordered, 1 for one step of the character set" default:"1"`
+	Threshold            *float64    `long:"threshold" description:"Luminance from 0 to 1 dividing the darkest character from the brightest, with no others"`
+	Otsu                 bool        `long:"otsu" description:"Picks the --threshold from the image with Otsu's method"`
+	Posterize            int         `long:"posterize" description:"Reduces the luminance to this many evenly spaced levels"`
+	PosterizeColor       bool        `long:"posterize-color" description:"Also reduces every color channel to --posterize levels"`
+	Format               string      `short:"f" long:"format" description:"The format of the output (default: inferred from the -o extension, otherwise text)" choice:"text" choice:"html" choice:"svg" choice:"png" choice:"pdf" choice:"json" choice:"latex" choice:"markdown" choice:"irc" choice:"ans" choice:"go" choice:"c" choice:"cast"`
+	Mode                 string      `long:"mode" description:"How pixels become characters" choice:"ascii" choice:"braille" choice:"halfblock" choice:"quadrant" choice:"sextant" default:"ascii"`
+	Edges                bool        `long:"edges" description:"Draws strong edges with directional characters"`
+	EdgeThreshold        float64     `long:"edge-threshold" description:"The gradient strength from 0 to 1 that counts as an edge" default:"0.3"`
+	EdgeChars            string      `long:"edge-chars" description:"The 8 edge characters, for gradients turning counterclockwise from east" default:"|\\-/|\\_/"`
+	EdgesOnly            bool        `long:"edges-only" description:"Picks the characters from the strength of the edges instead of the luminance"`
+	EdgeBlend            float64     `long:"edge-blend" description:"How much --edges-only uses the edges, 0 to 1, mixed with the luminance" default:"1"`
+	MapExpr              string      `long:"map-expr" description:"Picks characters by an expression of lum, r, g, b, x, y, width and height from 0 to 1"`
+	MapProgram           *Expr       `no-flag:"true"`
+	Invert               bool        `long:"invert" description:"Draws the dark pixels instead of the light ones in braille mode and uncolored block modes"`
+	CharWidth            int         `long:"char-width" description:"Repeats every character this many times to make up for tall terminal cells" default:"1"`
+	Color                string      `long:"color" description:"Colors the output using ANSI escape sequences" choice:"none" choice:"never" choice:"ansi16" choice:"ansi256" choice:"truecolor" choice:"gray" default:"none"`
+	ColorTarget          string      `long:"color-target" description:"Whether colors are applied to the characters, their background or both" choice:"fg" choice:"bg" choice:"both" default:"fg"`
+	ColorQuantize        int         `long:"color-quantize" description:"Rounds every color channel to this many bits, which makes output smaller, 0 to disable"`
+	Match                string      `long:"match" description:"How colors are matched to the ansi16, ansi256 and IRC palettes" choice:"rgb" choice:"lab" default:"rgb"`
+	Saturation           float64     `long:"saturation" description:"Scales the saturation of the output colors, 0 for gray" default:"1"`
+	HueRotate            float64     `long:"hue-rotate" description:"Turns the hue of the output colors by this many degrees"`
+	Colorize             string      `long:"colorize" description:"Colors the output from the luminance through a gradient: viridis, magma, amber or stops such as dark=#002233,light=#ffcc00"`
+	ColorizeStops        []colorStop `no-flag:"true"`
+
+	Frame            int      `long:"frame" description:"Converts only the given frame of an animated image, starting at 1"`
+	FrameDelimiter   string   `long:"frame-delimiter" description:"The line printed between frames of an animated image"`
+	LineEnding       string   `long:"line-ending" description:"The line ending of text output (default: lf, crlf for ans)" choice:"lf" choice:"crlf" choice:"native"`
+	FinalNewline     string   `long:"final-newline" description:"Whether the output ends with a line ending (default: as the format writes it)" choice:"true" choice:"false"`
+	Header           string   `long:"header" description:"Starts the output with a comment recording how it was made; auto leaves it out of pipes" choice:"never" choice:"auto" choice:"always" optional:"yes" optional-value:"auto" default:"never"`
+	HeaderPrefix     string   `long:"header-prefix" description:"The comment prefix of --header lines in formats without comments of their own" default:"#"`
+	Page             int      `long:"page" description:"Selects the page of a multi-page TIFF to convert, starting at 1" default:"1"`
+	IcoIndex         int      `long:"ico-index" description:"Selects the entry of an ICO file to convert, starting at 1 (default: largest)"`
+	MaxDownload      string   `long:"max-download" description:"The largest image that will be downloaded from a URL" default:"50M"`
+	NoAutoOrient     bool     `long:"no-auto-orient" description:"Ignores the EXIF orientation of JPEG images"`
+	HTMLBackground   string   `long:"html-background" description:"The background color of HTML output" default:"#000000"`
+	HTMLForeground   string   `long:"html-foreground" description:"The text color of HTML output when no color mode is active" default:"#ffffff"`
+	HTMLClasses      bool     `long:"html-classes" description:"Colors HTML output with one CSS class per color bucket instead of inline styles"`
+	HTMLPrecision    int      `long:"html-precision" description:"The bits kept per color channel by --html-classes" default:"4"`
+	SVGBackground    string   `long:"svg-background" description:"Draws a background of this color behind SVG output"`
+	SVGForeground    string   `long:"svg-foreground" description:"The text color of SVG output when no color mode is active" default:"#000000"`
+	ImageForeground  string   `long:"image-foreground" description:"The text color of PNG output when no color mode is active" default:"#ffffff"`
+	ImageBackground  string   `long:"image-background" description:"The background color of PNG output" default:"#000000"`
+	PDFPageSize      string   `long:"pdf-page-size" description:"The page size of PDF output" choice:"a4" choice:"letter" default:"a4"`
+	PDFOrientation   string   `long:"pdf-orientation" description:"The page orientation of PDF output" choice:"portrait" choice:"landscape" default:"portrait"`
+	PDFMargin        float64  `long:"pdf-margin" description:"The page margin of PDF output in points" default:"36"`
+	JSONCompact      bool     `long:"json-compact" description:"Writes JSON output as rows of strings with a parallel color array"`
+	LaTeXEnvironment string   `long:"latex-environment" description:"The environment wrapping LaTeX output; auto picks alltt when color is on" choice:"auto" choice:"verbatim" choice:"alltt" choice:"fancyvrb" default:"auto"`
+	LaTeXFontSize    string   `long:"latex-font-size" description:"The font size of LaTeX output" choice:"tiny" choice:"scriptsize" choice:"footnotesize" choice:"small" choice:"normalsize" default:"footnotesize"`
+	MarkdownHeading  bool     `long:"markdown-heading" description:"Precedes markdown output with a heading naming the input; always on when several inputs share one -o file"`
+	MarkdownMaxWidth int      `long:"markdown-max-width" description:"Warns when markdown output is wider than this many columns, 0 to disable" default:"120"`
+	IRCColors        int      `long:"irc-colors" description:"The number of mIRC colors to use in IRC output" choice:"16" choice:"99" default:"16"`
+	IRCBackground    bool     `long:"irc-background" description:"Colors the background rather than the characters in IRC output"`
+	IRCMaxWidth      int      `long:"irc-max-width" description:"Wraps IRC output so no line is longer than this many bytes, 0 to disable" default:"400"`
+	ANSWidth         int      `long:"ans-width" description:"The column count of .ANS output" default:"80"`
+	ANSTitle         string   `long:"ans-title" description:"The title stored in the SAUCE record of .ANS output"`
+	ANSAuthor        string   `long:"ans-author" description:"The author stored in the SAUCE record of .ANS output"`
+	ANSGroup         string   `long:"ans-group" description:"The group stored in the SAUCE record of .ANS output"`
+	ANSDate          string   `long:"ans-date" description:"The date (YYYYMMDD) stored in the SAUCE record of .ANS output, defaults to today"`
+	SourceName       string   `long:"source-name" description:"The identifier holding the art in Go and C output" default:"art"`
+	SourcePackage    string   `long:"source-package" description:"The package name of Go output" default:"main"`
+	Recursive        bool     `long:"recursive" description:"Descends into subdirectories of directory inputs"`
+	Ext              []string `long:"ext" description:"Only converts files with these extensions from directory inputs, e.g. png,jpg"`
+	FilesFrom        string   `long:"files-from" description:"Reads the list of inputs from a file, one per line (- for standard input)"`
+	Null             bool     `long:"null" description:"Separates the names read by --files-from with NUL characters instead of newlines"`
+	Member           string   `long:"member" description:"Only converts archive members matching this glob pattern, e.g. '*.png'"`
+	Raw              string   `long:"raw" description:"Reads the input as raw pixel data with the given dimensions and format (gray, rgb, bgr, rgba, bgra), e.g. 320x240:rgba"`
 }
 
-func luminance(color color.Color) float64 {
-	r, g, b, _ := color.RGBA()
+// parseResize reads a -r value of WIDTHxHEIGHT in cells. Either side may be
+// left out to derive it from the proportions of the image, corrected by the
+// cell aspect, or be a percentage of the image's size. A single percentage
+// applies to both sides.
+func parseResize(value string, img image.Image, cellAspect float64) (int, int, error) {
+	size := img.Bounds().Size()
+
+	if len(value) < 1 {
+		return size.X, size.Y, nil
+	}
+
+	split := strings.SplitN(value, "x", 2)
+
+	if len(split) < 2 && strings.HasSuffix(value, "%") {
+		split = []string{value, value}
+	}
 
-	red := float64(r) / math.MaxUint16
-	green := float64(g) / math.MaxUint16
-	blue := float64(b) / math.MaxUint16
+	if len(split) < 2 {
+		return 0, 0, fmt.Errorf("invalid -r value: %s", value)
+	}
 
-	return float64(0.299*float64(red) + 0.587*float64(green) + 0.114*float64(blue))
+	if len(split[0]) < 1 && len(split[1]) < 1 {
+		return 0, 0, fmt.Errorf("invalid -r value: %s: give a width, a height or both", value)
+	}
+
+	dimensions := [2]int{}
+
+	for i, part := range split {
+		if len(part) < 1 {
+			continue
+		}
+
+		if strings.HasSuffix(part, "%") {
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(part, "%"), 64)
+
+			if err != nil || percent <= 0 || math.IsInf(percent, 0) {
+				return 0, 0, fmt.Errorf("invalid -r value: %s: percentages must be numbers above 0", value)
+			}
+
+			dimensions[i] = int(math.Max(1, math.Round(float64([2]int{size.X, size.Y}[i])*percent/100)))
+
+			continue
+		}
+
+		dimension, err := strconv.ParseUint(part, 10, 32)
+
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid -r value: %s", value)
+		}
+
+		if dimension < 1 {
+			return 0, 0, fmt.Errorf("invalid -r value: %s: sizes must be at least 1", value)
+		}
+
+		dimensions[i] = int(dimension)
+	}
+
+	width, height := deriveSize(dimensions[0], dimensions[1], size, cellAspect)
+
+	return width, height, nil
 }
 
-func resize(img image.Image, width, height int) image.Image {
-	output := image.NewNRGBA(image.Rect(0, 0, width, height))
-	inputBounds := img.Bounds().Size()
+// deriveSize fills in a width or height of 0 from the proportions of an
+// image of the given size, corrected by the cell aspect.
+func deriveSize(width, height int, size image.Point, cellAspect float64) (int, int) {
+	aspect := float64(size.X) / float64(size.Y) / cellAspect
+
+	if width == 0 {
+		width = int(math.Max(1, math.Round(float64(height)*aspect)))
+	} else if height == 0 {
+		height = int(math.Max(1, math.Round(float64(width)/aspect)))
+	}
+
+	return width, height
+}
 
-	for x := 0; x < width; x++ {
-		for y := 0; y < height; y++ {
-			ix := int((float64(x) / float64(width)) * float64(inputBounds.X))
-			iy := int((float64(y) / float64(height)) * float64(inputBounds.Y))
+func convert(img image.Image, charset Ramp, formula lumaFormula) [][]Cell {
+	bounds := img.Bounds()
+	cells := make([][]Cell, bounds.Dy())
 
-			output.Set(x, y, img.At(ix, iy))
+	for y := range cells {
+		cells[y] = make([]Cell, bounds.Dx())
+
+		for x := range cells[y] {
+			pixel := img.At(bounds.Min.X+x, bounds.Min.Y+y)
+			lum := luminance(pixel, formula)
+
+			cells[y][x] = Cell{
+				Char:  charset.Char(lum),
+				Color: color.NRGBAModel.Convert(pixel).(color.NRGBA),
+				Lum:   lum,
+			}
 		}
 	}
 
-	return output
+	return cells
 }
 
-func parseResize(value string, img image.Image) (int, int, error) {
-	if len(value) < 1 {
-		size := img.Bounds().Size()
+func frameFileName(path string, index, count int) string {
+	ext := filepath.Ext(path)
+	digits := len(strconv.Itoa(count - 1))
 
-		return size.X, size.Y, nil
+	return fmt.Sprintf("%s.%0*d%s", strings.TrimSuffix(path, ext), digits, index, ext)
+}
+
+func convertInput(input *Input, charset Ramp, opts *Options) ([]Art, error) {
+	if opts.Verbose {
+		fmt.Printf("VERBOSE: Read input image from %s (%d bytes)\n", input.Name, len(input.Data))
 	}
 
-	split := strings.SplitN(value, "x", 2)
+	frames, format, err := decodeFrames(input.Data, opts)
 
-	if len(split) < 2 {
-		return 0, 0, fmt.Errorf("invalid resize value: %s", value)
+	if err != nil {
+		if len(input.Declared) > 0 {
+			err = fmt.Errorf("%w (declared as %s)", err, input.Declared)
+		}
+
+		return nil, fmt.Errorf("%s: %w", input.Name, err)
+	}
+
+	img := frames[0].Image
+
+	if opts.Verbose {
+		fmt.Printf("VERBOSE: Successfully parsed input image as %s\n", format)
+
+		if len(input.Declared) > 0 && input.Declared != format {
+			fmt.Printf("VERBOSE: Input '%s' was declared as %s but the content is %s\n", input.Name, input.Declared, format)
+		}
+
+		if format == "jpeg" {
+			fmt.Printf("VERBOSE: JPEG uses the %s color model\n", readJPEGInfo(input.Data).ColorModel())
+		}
+
+		if format == "webp" {
+			fmt.Printf("VERBOSE: Decoded %s %s WebP image\n", img.Bounds().Size(), webpVariant(input.Data))
+		}
+
+		if paletted, ok := img.(*image.Paletted); ok {
+			fmt.Printf("VERBOSE: Image uses a palette of %d colors\n", len(paletted.Palette))
+		}
+
+		if len(frames) > 1 {
+			fmt.Printf("VERBOSE: Image contains %d frames\n", len(frames))
+		}
+	}
+
+	if err := transformFrames(frames, opts); err != nil {
+		return nil, fmt.Errorf("%s: %w", input.Name, err)
 	}
 
-	width, err := strconv.ParseUint(split[0], 10, 32)
+	img = frames[0].Image
+
+	if opts.Frame != 0 {
+		if opts.Frame < 0 || opts.Frame > len(frames) {
+			return nil, fmt.Errorf("%s: invalid frame %d: image contains %d frames", input.Name, opts.Frame, len(frames))
+		}
+
+		frames = frames[opts.Frame-1 : opts.Frame]
+	}
+
+	ow, oh, err := parseResize(opts.Resize, img, opts.CellAspect)
 
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
-	height, err := strconv.ParseUint(split[1], 10, 32)
+	resized := len(opts.Resize) > 0
+	padTo := opts.CanvasSize
+	fillAspect := 0.0
+
+	// -r sizes that do not match the image's proportions are stretched,
+	// fitted inside, cropped to fill or fitted and padded.
+	if requested := (image.Point{ow, oh}); resized && opts.ResizeMode != "stretch" {
+		if opts.ResizeMode == "fill" {
+			fillAspect = float64(ow) / float64(oh) * opts.CellAspect
+		} else {
+			ow, oh = fitSize(img.Bounds().Size(), requested, opts.CellAspect)
+		}
+
+		if opts.ResizeMode == "pad" {
+			padTo = requested
+		}
+
+		if opts.Verbose {
+			fmt.Printf("VERBOSE: Resize mode %s made %dx%d characters of the requested %s\n", opts.ResizeMode, ow, oh, requested)
+		}
+	}
+
+	if opts.Fit {
+		ow, oh = fitSize(img.Bounds().Size(), opts.FitBox, opts.CellAspect)
+		resized = true
+	}
+
+	// Wide characters take two columns, so the ramp's width counts towards
+	// the width of every cell just like --char-width.
+	columns := opts.CharWidth
+
+	if opts.Mode == "ascii" {
+		columns *= charset.Width
+	}
+
+	if opts.CanvasSize.X > 0 {
+		ow, oh = fitSize(img.Bounds().Size(), opts.CanvasSize, opts.CellAspect)
+		resized = true
+	}
+
+	if opts.Cols > 0 || opts.Rows > 0 {
+		ow, oh = deriveSize(opts.Cols*columns/opts.CharWidth, opts.Rows, img.Bounds().Size(), opts.CellAspect)
+		resized = true
+	}
+
+	if cell := modeCellSizes[opts.Mode]; resized {
+		ow /= columns
+
+		if ow < 1 {
+			ow = 1
+		}
+
+		ow *= cell.X
+		oh *= cell.Y
+	}
+
+	if cell := modeCellSizes[opts.Mode]; opts.Scale != 0 {
+		size := img.Bounds().Size()
+
+		// Cells are narrower than tall, so the height shrinks by the cell
+		// aspect. Modes that pack more pixels per cell vertically and
+		// --char-width already make up for some of it.
+		ow = int(math.Max(1, float64(size.X)*opts.Scale))
+		oh = int(math.Max(1, math.Round(float64(size.Y)*opts.Scale*opts.CellAspect*float64(opts.CharWidth*cell.Y)/float64(cell.X))))
+	}
+
+	if !resized && columns > opts.CharWidth {
+		ow /= charset.Width
+
+		if ow < 1 {
+			ow = 1
+		}
+	}
+
+	ow, oh = limitSize(ow, oh, columns, modeCellSizes[opts.Mode], opts)
+
+	if err := checkSize(ow, oh, columns, modeCellSizes[opts.Mode], opts); err != nil {
+		return nil, fmt.Errorf("%s: %w", input.Name, err)
+	}
+
+	arts := make([]Art, 0, len(frames))
+
+	for _, frame := range frames {
+		source := frame.Image
+
+		if fillAspect > 0 {
+			source = cropToAspect(source, fillAspect, opts.Gravity)
+
+			if opts.Verbose {
+				fmt.Printf("VERBOSE: Cropped image from %s to %s to fill the requested size\n", frame.Image.Bounds().Size(), source.Bounds().Size())
+			}
+		}
+
+		filter := resizeFilter(opts.Filter, source, ow, oh)
+		mask := image.Image(nil)
+
+		if opts.Transparent == "blank" {
+			mask = resize(source, ow, oh, filter)
+		}
+
+		// Compositing before resizing keeps the background from fringing
+		// the soft edges of the image.
+		source = composite(source, opts.BackgroundColor)
+		processedImg, light := image.Image(nil), "sRGB"
+
+		switch {
+		case len(opts.Sample) > 0:
+			processedImg = sample(source, ow, oh, opts.Sample, opts)
+
+			if opts.Verbose {
+				fmt.Printf("VERBOSE: Sampled image from %s to %s with the %s of every cell\n", source.Bounds().Size(), processedImg.Bounds().Size(), opts.Sample)
+			}
+		// A nearest pixel is the same in either space.
+		case opts.LinearResize && filter != "nearest":
+			processedImg, light = resizeLinear(source, ow, oh, filter), "linear light"
+		default:
+			processedImg = resize(source, ow, oh, filter)
+		}
+
+		if opts.Verbose && len(opts.Sample) < 1 {
+			fmt.Printf("VERBOSE: Resized image from %s to %s with the %s filter in %s\n", source.Bounds().Size(), processedImg.Bounds().Size(), filter, light)
+		}
+
+		if opts.Denoise > 0 {
+			processedImg = denoise(processedImg, opts.Denoise)
+		}
+
+		if opts.Blur > 0 {
+			processedImg = blur(processedImg, opts.Blur)
+		}
+
+		if opts.Sharpen > 0 {
+			processedImg = sharpen(processedImg, opts.Sharpen)
+		}
+
+		if opts.Equalize {
+			processedImg = equalize(processedImg, opts.LumaFormula)
+		} else if opts.CLAHE {
+			processedImg = clahe(processedImg, opts)
+		}
+
+		// The curve maps the luminance and scales the channels with it,
+		// so the hues stay and the characters follow the brightness.
+		if curve := toneCurve(processedImg, opts); curve != nil {
+			processedImg = remapLuminance(processedImg, opts.LumaFormula, func(x, y int, lum float64) float64 { return curve(lum) })
+		}
+
+		if opts.Negative {
+			processedImg = applyTone(processedImg, func(v float64) float64 { return 1 - v })
+		}
+
+		cells, err := convertMode(processedImg, charset, opts)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", input.Name, err)
+		}
+
+		if opts.ColorizeStops != nil {
+			colorizeCells(cells, opts)
+		}
+
+		adjustColors(cells, opts)
+
+		if _, ok := paletteLevels[opts.Color]; ok && opts.Dither != "none" {
+			ditherColors(cells, opts)
+		}
+
+		if mask != nil {
+			blankTransparent(cells, mask, charset, opts)
+		}
+
+		cells = finishCells(cells, opts)
+
+		if padTo.X > 0 {
+			cells = padCells(cells, padTo, opts)
+		}
+
+		arts = append(arts, Art{
+			Source:     input.Name,
+			SourceSize: frame.Image.Bounds().Size(),
+			Charset:    string(charset.Chars),
+			Cells:      cells,
+			Delay:      frame.Delay,
+		})
+	}
+
+	return arts, nil
+}
+
+func process(input *Input, job job, charset Ramp, multiple bool, targets []*target, opts *Options, sum *summary) {
+	arts, err := convertInput(input, charset, opts)
+
+	if err == nil {
+		err = writeArts(arts, job, multiple, targets)
+	}
 
 	if err != nil {
-		return 0, 0, err
+		fmt.Fprintf(os.Stderr, "asciify: %s\n", err)
+
+		sum.Failed++
+
+		return
 	}
 
-	return int(width), int(height), nil
+	sum.Converted++
+}
+
+// fail reports an error that stops asciify before anything is converted,
+// such as an invalid option, and exits.
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "asciify: %s\n", err)
+	os.Exit(1)
 }
 
 func main() {
 	opts := &Options{}
 
-	args, err := flags.Parse(opts)
+	parser := flags.NewParser(opts, flags.Default)
+	args, err := parser.Parse()
 
 	if err != nil {
 		if flags.WroteHelp(err) {
 			return
 		}
 
-		panic(err)
+		// The parser has already printed the error.
+		os.Exit(1)
 	}
 
-	if len(args) < 1 {
-		panic(ErrNoInput)
+	if opts.ListCharsets || (len(args) > 0 && args[0] == "charsets") {
+		if len(args) > 0 && args[0] == "charsets" {
+			args = args[1:]
+		} else {
+			args = nil
+		}
+
+		if err := runCharsets(args, opts); err != nil {
+			fail(err)
+		}
+
+		return
 	}
 
-	if !strings.HasSuffix(args[0], ".png") && !strings.HasSuffix(args[0], ".jpg") && !strings.HasSuffix(args[0], ".jpeg") {
-		panic(fmt.Errorf("unknown image format: %s", args[0]))
+	if len(opts.FilesFrom) > 0 {
+		names, err := readFileList(opts.FilesFrom, opts.Null)
+
+		if err != nil {
+			fail(fmt.Errorf("--files-from: %w", err))
+		}
+
+		args = append(args, names...)
+
+		if len(args) < 1 {
+			fail(fmt.Errorf("--files-from: %s lists no inputs", opts.FilesFrom))
+		}
 	}
 
-	charset, ok := ChararacterSets[opts.Charset]
+	if len(args) < 1 {
+		if isTerminal(os.Stdin) {
+			fmt.Fprintf(os.Stderr, "asciify: %s\nPass the path of an image, or pipe one into standard input. See --help for all options.\n", ErrNoInput)
+			os.Exit(1)
+		}
 
-	if !ok {
-		panic(fmt.Errorf("unknown character set: %s", opts.Charset))
+		args = []string{stdinName}
 	}
 
-	if opts.Verbose {
-		fmt.Printf("VERBOSE: Found character set '%s' (%d characters)\n", opts.Charset, len(charset))
+	if opts.CharWidth < 1 {
+		fail(fmt.Errorf("--char-width must be at least 1, got %d", opts.CharWidth))
 	}
 
-	f, err := os.Open(args[0])
+	if err := checkMode(opts); err != nil {
+		fail(err)
+	}
 
-	if err != nil {
-		panic(err)
+	if !(opts.Scale >= 0) || math.IsInf(opts.Scale, 0) {
+		fail(fmt.Errorf("--scale must be a number above 0, got %g", opts.Scale))
 	}
 
-	defer f.Close()
+	if opts.MaxCells < 1 {
+		fail(fmt.Errorf("--max-cells must be at least 1, got %d", opts.MaxCells))
+	}
 
-	if opts.Verbose {
-		fmt.Printf("VERBOSE: Opened input image '%s'\n", args[0])
+	if opts.CellAspect <= 0 {
+		fail(fmt.Errorf("--cell-aspect must be above 0, got %g", opts.CellAspect))
 	}
 
-	var img image.Image = nil
+	if opts.Cols < 0 || opts.Rows < 0 {
+		fail(fmt.Errorf("--cols and --rows must be at least 1, got %d and %d", opts.Cols, opts.Rows))
+	}
 
-	if strings.HasSuffix(args[0], ".png") {
-		img, err = png.Decode(f)
+	if (opts.Cols > 0 || opts.Rows > 0) && (len(opts.Resize) > 0 || opts.Scale != 0 || opts.Fit) {
+		fail(fmt.Errorf("--cols and --rows cannot be combined with -r, --scale or --fit"))
+	}
 
-		if err != nil {
-			panic(err)
+	if opts.Fit {
+		if len(opts.Resize) > 0 || opts.Scale != 0 {
+			fail(fmt.Errorf("--fit cannot be combined with -r or --scale"))
 		}
-	} else {
-		img, err = jpeg.Decode(f)
 
-		if err != nil {
-			panic(err)
+		if opts.FitBox, err = fitBox(opts); err != nil {
+			fail(err)
 		}
 	}
 
-	if opts.Verbose {
-		fmt.Println("VERBOSE: Successfully parsed input image")
+	if opts.TrimTolerance < 0 || opts.TrimTolerance > 1 {
+		fail(fmt.Errorf("--trim-tolerance must be between 0 and 1, got %g", opts.TrimTolerance))
 	}
 
-	ow, oh, err := parseResize(opts.Resize, img)
+	if err := checkCanvas(opts); err != nil {
+		fail(err)
+	}
 
-	if err != nil {
-		panic(err)
+	if opts.BackgroundColor, err = parseHexColor(opts.Background); err != nil {
+		fail(fmt.Errorf("--background: %w", err))
 	}
 
-	if opts.Scale != 0 {
-		size := img.Bounds().Size()
+	if !(opts.TransparentThreshold >= 0 && opts.TransparentThreshold <= 1) {
+		fail(fmt.Errorf("--transparent-threshold must be between 0 and 1, got %g", opts.TransparentThreshold))
+	}
 
-		ow = int(float64(size.X) * opts.Scale)
-		oh = int(float64(size.Y) * opts.Scale)
+	if !resizeFilters[opts.Filter] {
+		fail(fmt.Errorf("invalid --filter: %s", opts.Filter))
 	}
 
-	processedImg := resize(img, ow, oh)
+	if err := checkEdges(opts); err != nil {
+		fail(err)
+	}
 
-	if opts.Verbose {
-		fmt.Printf("VERBOSE: Resized image from %s to %s\n", img.Bounds().Size(), processedImg.Bounds().Size())
+	if err := checkLuma(opts); err != nil {
+		fail(err)
 	}
 
-	result := &bytes.Buffer{}
+	if err := checkTone(opts); err != nil {
+		fail(err)
+	}
 
-	for y := 0; y < oh; y++ {
-		for x := 0; x < ow; x++ {
-			lum := luminance(processedImg.At(x, y))
-			char := charset[int(float64(len(charset))*lum)]
+	if err := checkConvolve(opts); err != nil {
+		fail(err)
+	}
 
-			if _, err = result.WriteString(fmt.Sprintf("%c", char)); err != nil {
-				panic(err)
-			}
+	if err := checkSample(opts); err != nil {
+		fail(err)
+	}
+
+	if err := checkColorAdjust(opts); err != nil {
+		fail(err)
+	}
+
+	if err := checkColorize(opts); err != nil {
+		fail(err)
+	}
+
+	if opts.ColorQuantize < 0 || opts.ColorQuantize > 8 {
+		fail(fmt.Errorf("--color-quantize must be 0 to 8 bits, got %d", opts.ColorQuantize))
+	}
+
+	if err := checkDither(opts); err != nil {
+		fail(err)
+	}
+
+	if err := checkThreshold(opts); err != nil {
+		fail(err)
+	}
+
+	if len(opts.MapExpr) > 0 {
+		if opts.MapProgram, err = compileExpr(opts.MapExpr); err != nil {
+			fail(err)
 		}
+	}
+
+	if parser.FindOptionByLongName("charset-string").IsSet() && len(opts.CharsetString) < 1 {
+		fail(fmt.Errorf("--charset-string must not be empty"))
+	}
+
+	charset, err := resolveCharset(opts)
+
+	if err != nil {
+		fail(err)
+	}
+
+	if opts.Verbose {
+		fmt.Printf("VERBOSE: Found character set '%s' (%d characters)\n", charsetName(opts), len(charset.Chars))
+	}
+
+	sum := &summary{}
+	jobs, multiple, err := collectJobs(args, opts, sum)
+
+	if err != nil {
+		fail(err)
+	}
+
+	targets, err := outputTargets(multiple, opts)
+
+	if err != nil {
+		fail(err)
+	}
+
+	for _, job := range jobs {
+		if len(job.Archive) > 0 {
+			err = walkArchive(job.Name, job.Archive, opts, func(member string, data []byte) error {
+				memberJob := job
+
+				memberJob.Name = displayName(job.Name) + ":" + member
+				memberJob.Output = memberOutputPath(member)
+
+				if len(opts.Raw) < 1 && len(detectFormat(data)) < 1 {
+					if opts.Verbose {
+						fmt.Printf("VERBOSE: Skipping '%s' which is not a recognized image\n", memberJob.Name)
+					}
+
+					sum.Skipped++
+
+					return nil
+				}
 
-		if y+1 != oh {
-			if _, err = result.WriteString("\n"); err != nil {
-				panic(err)
+				process(&Input{Name: memberJob.Name, Data: data, Declared: extensionFormat(member)}, memberJob, charset, multiple, targets, opts, sum)
+
+				return nil
+			})
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "asciify: %s: %s\n", displayName(job.Name), err)
+
+				sum.Failed++
 			}
+
+			continue
 		}
-	}
 
-	if len(opts.Output) > 0 {
-		outFile := args[0] + ".txt"
+		input, err := readInput(job.Name, opts)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "asciify: %s\n", err)
+
+			sum.Failed++
 
-		if len(opts.Output) > 0 {
-			outFile = opts.Output
+			continue
 		}
 
-		if err = ioutil.WriteFile(outFile, result.Bytes(), 0777); err != nil {
-			panic(err)
+		process(input, job, charset, multiple, targets, opts, sum)
+	}
+
+	for _, t := range targets {
+		if t.document == nil {
+			continue
 		}
 
-		if opts.Verbose {
-			fmt.Printf("VERBOSE: Successfully wrote output to '%s'\n", outFile)
+		if err = t.document.Commit(); err != nil {
+			fmt.Fprintf(os.Stderr, "asciify: %s\n", err)
+
+			sum.Failed++
 		}
+	}
 
-		return
+	if multiple {
+		fmt.Fprintf(os.Stderr, "asciify: %s\n", sum)
 	}
 
-	fmt.Println(result.String())
+	if sum.Failed > 0 {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// testOptions parses the arguments as the command line would and runs the
+// same validation main does, filling in the fields derived from the flags.
+func testOptions(t *testing.T, args ...string) *Options {
+	t.Helper()
+
+	opts := &Options{}
+
+	if _, err := flags.ParseArgs(opts, args); err != nil {
+		t.Fatalf("parsing %q: %s", args, err)
+	}
+
+	background, err := parseHexColor(opts.Background)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.BackgroundColor = background
+
+	for _, check := range []func(*Options) error{checkMode, checkCanvas, checkEdges, checkLuma, checkTone, checkConvolve, checkSample, checkColorAdjust, checkColorize, checkDither, checkThreshold} {
+		if err := check(opts); err != nil {
+			t.Fatalf("options %q: %s", args, err)
+		}
+	}
+
+	return opts
+}
+
+// encodePNG encodes the image for use as an input.
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	result := &bytes.Buffer{}
+
+	if err := png.Encode(result, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return result.Bytes()
+}
+
+// convertData converts the encoded image with the arguments and returns the
+// art of its first frame.
+func convertData(t *testing.T, data []byte, args ...string) Art {
+	t.Helper()
+
+	opts := testOptions(t, args...)
+	charset, err := resolveCharset(opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arts, err := convertInput(&Input{Name: "test", Data: data}, charset, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return arts[0]
+}
+
+// convertImage converts the image as a PNG input.
+func convertImage(t *testing.T, img image.Image, args ...string) Art {
+	t.Helper()
+
+	return convertData(t, encodePNG(t, img), args...)
+}
+
+// artRows returns the characters of every row of the art.
+func artRows(art Art) []string {
+	rows := make([]string, len(art.Cells))
+
+	for y, row := range art.Cells {
+		chars := make([]rune, len(row))
+
+		for x, cell := range row {
+			chars[x] = cell.Char
+		}
+
+		rows[y] = string(chars)
+	}
+
+	return rows
+}
+
+// grayImage returns an image of the given size where every pixel has the
+// gray level value returns for it.
+func grayImage(width, height int, value func(x, y int) uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := value(x, y)
+
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+
+	return img
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// markdownFence returns a backtick fence longer than any run of backticks in
+// the art, so that the art cannot close the code block early.
+func markdownFence(art Art) string {
+	longest := 0
+
+	for _, row := range art.Cells {
+		run := 0
+
+		for _, cell := range row {
+			if cell.Char != '`' {
+				run = 0
+
+				continue
+			}
+
+			if run++; run > longest {
+				longest = run
+			}
+		}
+	}
+
+	if longest < 3 {
+		return "```"
+	}
+
+	return strings.Repeat("`", longest+1)
+}
+
+// combineMarkdown reports whether every input is written as a section of the
+// single markdown document named by -o. Unlike other formats, an -o path that
+// does not exist yet is taken as that document unless it ends in a separator.
+func combineMarkdown(multiple bool, opts *Options) bool {
+	if opts.Format != "markdown" || !multiple || len(opts.Output) < 1 || strings.HasSuffix(opts.Output, string(os.PathSeparator)) {
+		return false
+	}
+
+	info, err := os.Stat(opts.Output)
+
+	return (err != nil && os.IsNotExist(err)) || (err == nil && !info.IsDir())
+}
+
+func renderMarkdown(art Art, opts *Options) ([]byte, error) {
+	result := &bytes.Buffer{}
+	fence := markdownFence(art)
+
+	if width := artColumns(art); opts.MarkdownMaxWidth > 0 && width > opts.MarkdownMaxWidth {
+		fmt.Fprintf(os.Stderr, "asciify: warning: %s is %d columns wide, which is more than the --markdown-max-width of %d\n", art.Source, width, opts.MarkdownMaxWidth)
+	}
+
+	if opts.MarkdownHeading {
+		fmt.Fprintf(result, "## %s\n\n", art.Source)
+	}
+
+	fmt.Fprintf(result, "%stext\n", fence)
+
+	for _, row := range art.Cells {
+		for _, cell := range row {
+			result.WriteRune(cell.Char)
+		}
+
+		result.WriteString("\n")
+	}
+
+	fmt.Fprintf(result, "%s\n", fence)
+
+	return result.Bytes(), nil
+}
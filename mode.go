@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"unicode"
+)
+
+// modeCellSizes is the number of pixels packed into one character by each
+// rendering mode.
+var modeCellSizes = map[string]image.Point{
+	"ascii":     {1, 1},
+	"braille":   {2, 4},
+	"halfblock": {1, 2},
+	"quadrant":  {2, 2},
+	"sextant":   {2, 3},
+}
+
+func checkMode(opts *Options) error {
+	if opts.Mode == "halfblock" && !colorEnabled(opts) {
+		return fmt.Errorf("--mode=halfblock needs a color mode, e.g. --color=truecolor")
+	}
+
+	if len(opts.MapExpr) > 0 && opts.Mode != "ascii" {
+		return fmt.Errorf("--map-expr only works with --mode=ascii")
+	}
+
+	return nil
+}
+
+func convertMode(img image.Image, charset Ramp, opts *Options) ([][]Cell, error) {
+	threshold, thresholded := resolveThreshold(img, opts)
+
+	switch opts.Mode {
+	case "braille":
+		return convertBraille(img, threshold, opts), nil
+	case "halfblock":
+		return convertHalfblock(img, opts.LumaFormula), nil
+	case "quadrant":
+		return convertBlocks(img, modeCellSizes["quadrant"], func(mask int) rune { return quadrantGlyphs[mask] }, threshold, opts), nil
+	case "sextant":
+		return convertBlocks(img, modeCellSizes["sextant"], sextantGlyph, threshold, opts), nil
+	}
+
+	cells := convert(img, charset, opts.LumaFormula)
+
+	if opts.EdgesOnly {
+		applyEdgesOnly(cells, img, charset, opts)
+	}
+
+	if opts.Dither != "none" || thresholded || opts.Posterize > 0 {
+		ditherCells(cells, charset, threshold, thresholded, opts)
+	}
+
+	if opts.Posterize > 0 {
+		posterizeCells(cells, opts)
+	}
+
+	if opts.MapProgram != nil {
+		if err := applyMapExpr(cells, img, charset, opts.MapProgram); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Edges {
+		applyEdges(cells, img, opts)
+	}
+
+	return cells, nil
+}
+
+// blankTransparent replaces every cell whose pixels in the mask average less
+// than --transparent-threshold alpha with a space carrying no color.
+func blankTransparent(cells [][]Cell, mask image.Image, charset Ramp, opts *Options) {
+	cell := modeCellSizes[opts.Mode]
+	bounds := mask.Bounds()
+	blank := ' '
+
+	if opts.Mode == "ascii" && charset.Width > 1 {
+		blank = '\u3000'
+	}
+
+	for y, row := range cells {
+		for x := range row {
+			alpha, count := 0.0, 0
+
+			for py := y * cell.Y; py < (y+1)*cell.Y && py < bounds.Dy(); py++ {
+				for px := x * cell.X; px < (x+1)*cell.X && px < bounds.Dx(); px++ {
+					_, _, _, a := mask.At(bounds.Min.X+px, bounds.Min.Y+py).RGBA()
+					alpha += float64(a) / 0xffff
+					count++
+				}
+			}
+
+			if count > 0 && alpha/float64(count) < opts.TransparentThreshold {
+				row[x] = Cell{Char: blank, Plain: true}
+			}
+		}
+	}
+}
+
+// finishCells applies the options that work on the mapped cells rather than
+// on pixels.
+func finishCells(cells [][]Cell, opts *Options) [][]Cell {
+	cells = widenCells(cells, opts.CharWidth)
+
+	if opts.ColorQuantize > 0 && opts.ColorQuantize < 8 {
+		quantizeColors(cells, opts.ColorQuantize)
+	}
+
+	if opts.Trim {
+		trimCells(cells)
+	}
+
+	return cells
+}
+
+// trimCells removes the whitespace at the end of every row, so that no color
+// is written for it either.
+func trimCells(cells [][]Cell) {
+	for y, row := range cells {
+		end := len(row)
+
+		for end > 0 && unicode.IsSpace(row[end-1].Char) {
+			end--
+		}
+
+		cells[y] = row[:end]
+	}
+}
+
+// widenCells repeats every cell width times.
+func widenCells(cells [][]Cell, width int) [][]Cell {
+	if width < 2 {
+		return cells
+	}
+
+	for y, row := range cells {
+		wide := make([]Cell, 0, len(row)*width)
+
+		for _, cell := range row {
+			for i := 0; i < width; i++ {
+				wide = append(wide, cell)
+			}
+		}
+
+		cells[y] = wide
+	}
+
+	return cells
+}
+
+func averageColor(pixels []color.NRGBA) color.NRGBA {
+	if len(pixels) < 1 {
+		return color.NRGBA{}
+	}
+
+	var r, g, b, a int
+
+	for _, p := range pixels {
+		r += int(p.R)
+		g += int(p.G)
+		b += int(p.B)
+		a += int(p.A)
+	}
+
+	n := len(pixels)
+
+	return color.NRGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / n)}
+}
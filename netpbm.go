@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+)
+
+type netpbmHeader struct {
+	Magic  string
+	Width  int
+	Height int
+	MaxVal int
+}
+
+func init() {
+	for _, magic := range []string{"P1", "P4"} {
+		image.RegisterFormat("pbm", magic, decodeNetpbm, decodeNetpbmConfig)
+	}
+
+	for _, magic := range []string{"P2", "P5"} {
+		image.RegisterFormat("pgm", magic, decodeNetpbm, decodeNetpbmConfig)
+	}
+
+	for _, magic := range []string{"P3", "P6"} {
+		image.RegisterFormat("ppm", magic, decodeNetpbm, decodeNetpbmConfig)
+	}
+}
+
+func readNetpbmToken(r *bufio.Reader) (string, error) {
+	token := make([]byte, 0, 8)
+
+	for {
+		b, err := r.ReadByte()
+
+		if err != nil {
+			if err == io.EOF && len(token) > 0 {
+				return string(token), nil
+			}
+
+			return "", err
+		}
+
+		switch {
+		case b == '#':
+			if _, err = r.ReadString('\n'); err != nil && err != io.EOF {
+				return "", err
+			}
+
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, b)
+		}
+	}
+}
+
+func readNetpbmInt(r *bufio.Reader, name string) (int, error) {
+	token, err := readNetpbmToken(r)
+
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %w", name, err)
+	}
+
+	value, err := strconv.Atoi(token)
+
+	if err != nil || value < 1 {
+		return 0, fmt.Errorf("invalid %s: %s", name, token)
+	}
+
+	return value, nil
+}
+
+func readNetpbmHeader(r *bufio.Reader) (*netpbmHeader, error) {
+	magic, err := readNetpbmToken(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(magic) != 2 || magic[0] != 'P' || magic[1] < '1' || magic[1] > '6' {
+		return nil, fmt.Errorf("invalid netpbm magic: %q", magic)
+	}
+
+	header := &netpbmHeader{Magic: magic, MaxVal: 1}
+
+	if header.Width, err = readNetpbmInt(r, "width"); err != nil {
+		return nil, err
+	}
+
+	if header.Height, err = readNetpbmInt(r, "height"); err != nil {
+		return nil, err
+	}
+
+	if header.Width > 1<<15 || header.Height > 1<<15 {
+		return nil, fmt.Errorf("invalid netpbm dimensions: %dx%d", header.Width, header.Height)
+	}
+
+	if magic != "P1" && magic != "P4" {
+		if header.MaxVal, err = readNetpbmInt(r, "maxval"); err != nil {
+			return nil, err
+		}
+
+		if header.MaxVal > math.MaxUint16 {
+			return nil, fmt.Errorf("invalid maxval: %d", header.MaxVal)
+		}
+	}
+
+	return header, nil
+}
+
+func decodeNetpbmConfig(r io.Reader) (image.Config, error) {
+	header, err := readNetpbmHeader(bufio.NewReader(r))
+
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	model := color.RGBA64Model
+
+	switch header.Magic {
+	case "P1", "P4":
+		model = color.GrayModel
+	case "P2", "P5":
+		model = color.Gray16Model
+	}
+
+	return image.Config{ColorModel: model, Width: header.Width, Height: header.Height}, nil
+}
+
+func decodeNetpbm(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	header, err := readNetpbmHeader(br)
+
+	if err != nil {
+		return nil, err
+	}
+
+	channels := 1
+
+	if header.Magic == "P3" || header.Magic == "P6" {
+		channels = 3
+	}
+
+	count := header.Width * header.Height * channels
+	var samples []int
+
+	// The readers grow the samples as the data arrives, so a header claiming
+	// a huge image fails on the missing data rather than allocating for it.
+	switch header.Magic {
+	case "P1":
+		samples, err = readPlainBits(br, count)
+	case "P2", "P3":
+		samples, err = readPlainSamples(br, count, header.MaxVal)
+	case "P4":
+		samples, err = readPackedBits(br, count, header.Width)
+	case "P5", "P6":
+		samples, err = readRawSamples(br, count, header.MaxVal)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := image.Rect(0, 0, header.Width, header.Height)
+
+	switch header.Magic {
+	case "P1", "P4":
+		img := image.NewGray(bounds)
+
+		for i, sample := range samples {
+			// A set bit is black in a bitmap
+			img.Pix[i] = uint8(255 * (1 - sample))
+		}
+
+		return img, nil
+	case "P2", "P5":
+		img := image.NewGray16(bounds)
+
+		for i, sample := range samples {
+			img.SetGray16(i%header.Width, i/header.Width, color.Gray16{Y: scaleNetpbmSample(sample, header.MaxVal)})
+		}
+
+		return img, nil
+	}
+
+	img := image.NewRGBA64(bounds)
+
+	for i := 0; i < len(samples); i += 3 {
+		pixel := i / 3
+
+		img.SetRGBA64(pixel%header.Width, pixel/header.Width, color.RGBA64{
+			R: scaleNetpbmSample(samples[i], header.MaxVal),
+			G: scaleNetpbmSample(samples[i+1], header.MaxVal),
+			B: scaleNetpbmSample(samples[i+2], header.MaxVal),
+			A: math.MaxUint16,
+		})
+	}
+
+	return img, nil
+}
+
+func scaleNetpbmSample(value, maxVal int) uint16 {
+	return uint16((value*math.MaxUint16 + maxVal/2) / maxVal)
+}
+
+// netpbmChunk is the most samples read ahead of the data that is present.
+const netpbmChunk = 1 << 16
+
+func netpbmCapacity(count int) int {
+	if count > netpbmChunk {
+		return netpbmChunk
+	}
+
+	return count
+}
+
+func readPlainBits(r *bufio.Reader, count int) ([]int, error) {
+	samples := make([]int, 0, netpbmCapacity(count))
+
+	for len(samples) < count {
+		b, err := r.ReadByte()
+
+		if err != nil {
+			return nil, fmt.Errorf("reading sample %d: %w", len(samples), err)
+		}
+
+		switch b {
+		case '0', '1':
+			samples = append(samples, int(b-'0'))
+		case '#':
+			if _, err = r.ReadString('\n'); err != nil {
+				return nil, fmt.Errorf("reading sample %d: %w", len(samples), err)
+			}
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+		default:
+			return nil, fmt.Errorf("invalid bitmap sample: %q", b)
+		}
+	}
+
+	return samples, nil
+}
+
+func readPlainSamples(r *bufio.Reader, count, maxVal int) ([]int, error) {
+	samples := make([]int, 0, netpbmCapacity(count))
+
+	for len(samples) < count {
+		token, err := readNetpbmToken(r)
+
+		if err != nil {
+			return nil, fmt.Errorf("reading sample %d: %w", len(samples), err)
+		}
+
+		value, err := strconv.Atoi(token)
+
+		if err != nil || value < 0 || value > maxVal {
+			return nil, fmt.Errorf("invalid sample: %s", token)
+		}
+
+		samples = append(samples, value)
+	}
+
+	return samples, nil
+}
+
+func readPackedBits(r *bufio.Reader, count, width int) ([]int, error) {
+	samples := make([]int, 0, netpbmCapacity(count))
+	row := make([]byte, (width+7)/8)
+
+	for y := 0; y < count/width; y++ {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return nil, fmt.Errorf("reading row %d: %w", y, err)
+		}
+
+		for x := 0; x < width; x++ {
+			samples = append(samples, int(row[x/8]>>(7-uint(x%8)))&1)
+		}
+	}
+
+	return samples, nil
+}
+
+func readRawSamples(r *bufio.Reader, count, maxVal int) ([]int, error) {
+	size := 1
+
+	if maxVal > 255 {
+		size = 2
+	}
+
+	samples := make([]int, 0, netpbmCapacity(count))
+	buf := make([]byte, netpbmCapacity(count)*size)
+
+	for len(samples) < count {
+		chunk := buf[:netpbmCapacity(count-len(samples))*size]
+
+		if n, err := io.ReadFull(r, chunk); err != nil {
+			return nil, fmt.Errorf("raster truncated after %d of %d bytes: %w", len(samples)*size+n, count*size, err)
+		}
+
+		for i := 0; i < len(chunk); i += size {
+			sample := int(chunk[i])
+
+			if size == 2 {
+				sample = sample<<8 | int(chunk[i+1])
+			}
+
+			if sample > maxVal {
+				return nil, errors.New("sample exceeds maxval")
+			}
+
+			samples = append(samples, sample)
+		}
+	}
+
+	return samples, nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const stdoutName = "-"
+
+// atomicFile is written under a temporary name in the directory of its
+// destination and only replaces the destination once Commit is called, so
+// that a failed write never leaves a half-written file behind.
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+func createAtomic(path string) (*atomicFile, error) {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot write %s: %w", path, err)
+	}
+
+	return &atomicFile{File: file, path: path}, nil
+}
+
+func (f *atomicFile) Commit() error {
+	err := f.Chmod(0644)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+
+		return fmt.Errorf("cannot write %s: %w", f.path, err)
+	}
+
+	return nil
+}
+
+func (f *atomicFile) Abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// writeFile writes the file at path through write, leaving any previous file
+// untouched if it fails.
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := createAtomic(path)
+
+	if err != nil {
+		return err
+	}
+
+	if err = write(file); err != nil {
+		file.Abort()
+
+		return fmt.Errorf("cannot write %s: %w", path, err)
+	}
+
+	return file.Commit()
+}
+
+func outputIsDirectory(multiple bool, opts *Options) bool {
+	if strings.HasSuffix(opts.Output, string(os.PathSeparator)) {
+		return true
+	}
+
+	info, err := os.Stat(opts.Output)
+
+	if err != nil {
+		return multiple && os.IsNotExist(err)
+	}
+
+	return info.IsDir()
+}
+
+// outputPath returns the file the output for job is written to, or an empty
+// string for standard output.
+func outputPath(job job, multiple bool, opts *Options) (string, error) {
+	ext := formatExtensions[opts.Format]
+	path := opts.Output
+
+	switch {
+	case opts.Save && len(job.Archive) < 1 && job.Name != stdinName && !isURL(job.Name) && !isDataURI([]byte(job.Name)):
+		return job.Name + ext, nil
+	case opts.Save:
+		path = job.Output + ext
+	case len(opts.Output) < 1:
+		return "", nil
+	case outputIsDirectory(multiple, opts):
+		path = filepath.Join(opts.Output, job.Output+ext)
+	default:
+		return path, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// target is one destination of the output with the options it is rendered
+// with, and the document shared by all inputs when they become sections of
+// one markdown file.
+type target struct {
+	opts     *Options
+	document *atomicFile
+}
+
+// colorFormats lists the formats whose whole point is their color codes.
+var colorFormats = map[string]bool{
+	"irc": true,
+	"ans": true,
+}
+
+func extensionFormatOf(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	for format, formatExt := range formatExtensions {
+		if ext == formatExt {
+			return format
+		}
+	}
+
+	return ""
+}
+
+// outputTargets returns a target for every -o, splitting comma separated
+// lists. Without --format each file is written in the format of its
+// extension.
+func outputTargets(multiple bool, opts *Options) ([]*target, error) {
+	names := make([]string, 0, len(opts.Outputs))
+
+	for _, value := range opts.Outputs {
+		names = append(names, strings.Split(value, ",")...)
+	}
+
+	if len(names) < 1 {
+		names = append(names, "")
+	}
+
+	targets := make([]*target, 0, len(names))
+
+	for _, name := range names {
+		targetOpts := *opts
+
+		if name == stdoutName {
+			name = ""
+		}
+
+		targetOpts.Output = name
+
+		if len(targetOpts.Format) < 1 {
+			targetOpts.Format = extensionFormatOf(name)
+		}
+
+		if len(targetOpts.Format) < 1 {
+			targetOpts.Format = "text"
+		}
+
+		if colorFormats[targetOpts.Format] && !colorEnabled(opts) {
+			return nil, fmt.Errorf("--format=%s needs a color mode, e.g. --color=ansi16", targetOpts.Format)
+		}
+
+		if targetOpts.Save && len(name) > 0 {
+			return nil, fmt.Errorf("--save cannot be combined with -o")
+		}
+
+		if multiple && len(name) > 0 && !combineMarkdown(multiple, &targetOpts) && !outputIsDirectory(multiple, &targetOpts) {
+			return nil, fmt.Errorf("output %s must be a directory when converting multiple inputs", name)
+		}
+
+		targets = append(targets, &target{opts: &targetOpts})
+	}
+
+	for _, t := range targets {
+		if combineMarkdown(multiple, t.opts) {
+			document, err := createAtomic(t.opts.Output)
+
+			if err != nil {
+				return nil, err
+			}
+
+			t.opts.MarkdownHeading = true
+			t.document = document
+		}
+	}
+
+	return targets, nil
+}
+
+// writeArts writes the arts to every target.
+func writeArts(arts []Art, job job, multiple bool, targets []*target) error {
+	for _, t := range targets {
+		if err := writeTarget(arts, job, multiple, t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTarget writes the rendered arts to standard output, to the sections of
+// the combined document, or to one file per frame.
+func writeTarget(arts []Art, job job, multiple bool, t *target) error {
+	opts := t.opts
+	outputs, err := renderArts(arts, opts)
+
+	if err != nil {
+		return err
+	}
+
+	path, err := outputPath(job, multiple, opts)
+
+	if err != nil {
+		return err
+	}
+
+	header := opts.Header == "always" || (opts.Header == "auto" && (len(path) > 0 || t.document != nil || isTerminal(os.Stdout)))
+
+	for i := range outputs {
+		if header && len(arts) > 0 {
+			outputs[i] = addHeader(outputs[i], arts[0], opts)
+		}
+
+		outputs[i] = applyFinalNewline(outputs[i], opts)
+	}
+
+	if t.document != nil {
+		w := newOutputWriter(t.document, opts)
+
+		for _, output := range outputs {
+			if _, err = w.Write(append(output, '\n')); err != nil {
+				return fmt.Errorf("cannot write %s: %w", opts.Output, err)
+			}
+		}
+
+		return nil
+	}
+
+	if len(path) < 1 {
+		return writeStdout(outputs, job, multiple, opts)
+	}
+
+	for i, output := range outputs {
+		frameFile := path
+
+		if len(outputs) > 1 {
+			frameFile = frameFileName(path, i, len(outputs))
+		}
+
+		err = writeFile(frameFile, func(w io.Writer) error {
+			_, err := newOutputWriter(w, opts).Write(output)
+
+			return err
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if opts.Verbose {
+			fmt.Printf("VERBOSE: Successfully wrote output to '%s' (%d bytes)\n", frameFile, len(output))
+		}
+	}
+
+	return nil
+}
+
+func writeStdout(outputs [][]byte, job job, multiple bool, opts *Options) error {
+	w := newOutputWriter(os.Stdout, opts)
+
+	if multiple {
+		fmt.Fprintf(w, "==> %s <==\n", job.Name)
+	}
+
+	for i, output := range outputs {
+		if i > 0 {
+			fmt.Fprintln(w, opts.FrameDelimiter)
+		}
+
+		if _, err := w.Write(output); err != nil {
+			return err
+		}
+
+		if opts.FinalNewline != "false" && !strings.HasSuffix(string(output), "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ansi16Palette = []color.NRGBA{
+	{0, 0, 0, 255},
+	{205, 0, 0, 255},
+	{0, 205, 0, 255},
+	{205, 205, 0, 255},
+	{0, 0, 238, 255},
+	{205, 0, 205, 255},
+	{0, 205, 205, 255},
+	{229, 229, 229, 255},
+	{127, 127, 127, 255},
+	{255, 0, 0, 255},
+	{0, 255, 0, 255},
+	{255, 255, 0, 255},
+	{92, 92, 255, 255},
+	{255, 0, 255, 255},
+	{0, 255, 255, 255},
+	{255, 255, 255, 255},
+}
+
+// colorDistance approximates perceived color difference using the "redmean"
+// weighting, which is far closer to human perception than plain RGB distance
+// at a fraction of the cost of a proper color space conversion.
+func colorDistance(a, b color.NRGBA) float64 {
+	rmean := (float64(a.R) + float64(b.R)) / 2
+	dr := float64(a.R) - float64(b.R)
+	dg := float64(a.G) - float64(b.G)
+	db := float64(a.B) - float64(b.B)
+
+	return (2+rmean/256)*dr*dr + 4*dg*dg + (2+(255-rmean)/256)*db*db
+}
+
+// nearestColor returns the index of the palette color closest to c, compared
+// in L*a*b* through labs, the same palette converted by labPalette, when the
+// --match mode is lab.
+func nearestColor(c color.NRGBA, palette []color.NRGBA, labs []labColor, match string) int {
+	if match == "lab" {
+		return nearestLab(c, labs, 0)
+	}
+
+	best, bestDistance := 0, colorDistance(c, palette[0])
+
+	for i := 1; i < len(palette); i++ {
+		if distance := colorDistance(c, palette[i]); distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+
+	return best
+}
+
+func nearestANSI16(c color.NRGBA, match string) int {
+	return nearestColor(c, ansi16Palette, ansi16Lab, match)
+}
+
+func ansi16Code(index int) int {
+	if index < 8 {
+		return 30 + index
+	}
+
+	return 90 + index - 8
+}
+
+var ansi256CubeLevels = []uint8{0, 95, 135, 175, 215, 255}
+
+func nearestCubeLevel(value uint8) int {
+	switch {
+	case value < 48:
+		return 0
+	case value < 115:
+		return 1
+	}
+
+	return (int(value) - 35) / 40
+}
+
+// nearestANSI256 maps a color to the xterm 256-color palette by picking the
+// closer of the nearest 6×6×6 cube entry and the nearest grayscale ramp entry.
+func nearestANSI256(c color.NRGBA, match string) int {
+	if match == "lab" {
+		return nearestANSI256Lab(c)
+	}
+
+	r, g, b := nearestCubeLevel(c.R), nearestCubeLevel(c.G), nearestCubeLevel(c.B)
+	cube := color.NRGBA{ansi256CubeLevels[r], ansi256CubeLevels[g], ansi256CubeLevels[b], 255}
+	average := (int(c.R) + int(c.G) + int(c.B)) / 3
+	grayIndex := (average - 3) / 10
+
+	if grayIndex < 0 {
+		grayIndex = 0
+	} else if grayIndex > 23 {
+		grayIndex = 23
+	}
+
+	grayValue := uint8(8 + grayIndex*10)
+	gray := color.NRGBA{grayValue, grayValue, grayValue, 255}
+
+	if colorDistance(c, gray) < colorDistance(c, cube) {
+		return 232 + grayIndex
+	}
+
+	return 16 + 36*r + 6*g + b
+}
+
+// grayRampIndex maps a luminance onto the 24 steps of the 256-color
+// grayscale ramp, clamping at both ends.
+func grayRampIndex(lum float64) int {
+	step := int(lum * 24)
+
+	if step < 0 {
+		step = 0
+	} else if step > 23 {
+		step = 23
+	}
+
+	return 232 + step
+}
+
+func ansi256Color(index int) color.NRGBA {
+	switch {
+	case index < 16:
+		return ansi16Palette[index]
+	case index >= 232:
+		value := uint8(8 + (index-232)*10)
+
+		return color.NRGBA{value, value, value, 255}
+	}
+
+	index -= 16
+
+	return color.NRGBA{ansi256CubeLevels[index/36], ansi256CubeLevels[index/6%6], ansi256CubeLevels[index%6], 255}
+}
+
+func parseHexColor(value string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	if len(hex) != 6 {
+		return color.NRGBA{}, fmt.Errorf("invalid hex color: %s", value)
+	}
+
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid hex color: %s", value)
+	}
+
+	return color.NRGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 255}, nil
+}
+
+func hexColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// quantizeColors rounds every channel of the cell colors to the given number
+// of bits, so neighbouring cells of nearly the same color share one escape
+// sequence.
+func quantizeColors(cells [][]Cell, bits int) {
+	steps := float64(int(1)<<uint(bits) - 1)
+	channel := func(v uint8) uint8 { return uint8(math.Round(math.Round(float64(v)/255*steps) / steps * 255)) }
+	quantize := func(c color.NRGBA) color.NRGBA { return color.NRGBA{channel(c.R), channel(c.G), channel(c.B), c.A} }
+
+	for _, row := range cells {
+		for x := range row {
+			row[x].Color = quantize(row[x].Color)
+
+			if row[x].Background != nil {
+				background := quantize(*row[x].Background)
+				row[x].Background = &background
+			}
+		}
+	}
+}
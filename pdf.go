@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+const (
+	pdfCharWidth   = 0.6
+	pdfMaxFontSize = 12.0
+)
+
+var pdfPageSizes = map[string][2]float64{
+	"a4":     {595.28, 841.89},
+	"letter": {612, 792},
+}
+
+func escapePDFString(runes []rune) string {
+	result := &bytes.Buffer{}
+
+	for _, r := range runes {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			result.WriteByte('\\')
+			result.WriteRune(r)
+		case r < 32 || r > 255:
+			result.WriteByte('?')
+		case r > 126:
+			fmt.Fprintf(result, "\\%03o", r)
+		default:
+			result.WriteRune(r)
+		}
+	}
+
+	return result.String()
+}
+
+func renderPDF(art Art, opts *Options) ([]byte, error) {
+	size, ok := pdfPageSizes[opts.PDFPageSize]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown page size: %s", opts.PDFPageSize)
+	}
+
+	pageWidth, pageHeight := size[0], size[1]
+
+	if opts.PDFOrientation == "landscape" {
+		pageWidth, pageHeight = pageHeight, pageWidth
+	}
+
+	margin := opts.PDFMargin
+	usableWidth := pageWidth - 2*margin
+	usableHeight := pageHeight - 2*margin
+
+	if usableWidth <= 0 || usableHeight <= 0 {
+		return nil, fmt.Errorf("--pdf-margin of %g leaves no room on the page", margin)
+	}
+
+	columns := artWidth(art)
+
+	if columns < 1 {
+		columns = 1
+	}
+
+	fontSize := math.Min(pdfMaxFontSize, usableWidth/(float64(columns)*pdfCharWidth))
+	rowsPerPage := int(usableHeight / fontSize)
+
+	if rowsPerPage < 1 {
+		rowsPerPage = 1
+	}
+
+	contents := make([][]byte, 0)
+	colored := colorEnabled(opts)
+
+	for start := 0; start < len(art.Cells) || start == 0; start += rowsPerPage {
+		end := start + rowsPerPage
+
+		if end > len(art.Cells) {
+			end = len(art.Cells)
+		}
+
+		stream := &bytes.Buffer{}
+
+		fmt.Fprintf(stream, "BT\n/F1 %.3f Tf\n%.3f TL\n%.3f %.3f Td\n", fontSize, fontSize, margin, pageHeight-margin-fontSize*0.8)
+
+		for _, row := range art.Cells[start:end] {
+			for x := 0; x < len(row); {
+				c := displayColor(row[x], opts)
+				run := []rune{row[x].Char}
+
+				for x++; x < len(row) && (!colored || displayColor(row[x], opts) == c); x++ {
+					run = append(run, row[x].Char)
+				}
+
+				if colored {
+					fmt.Fprintf(stream, "%.3f %.3f %.3f rg\n", float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+				}
+
+				fmt.Fprintf(stream, "(%s) Tj\n", escapePDFString(run))
+			}
+
+			stream.WriteString("T*\n")
+		}
+
+		stream.WriteString("ET\n")
+		contents = append(contents, stream.Bytes())
+
+		if end >= len(art.Cells) {
+			break
+		}
+	}
+
+	if opts.Verbose {
+		fmt.Printf("VERBOSE: Laid out %d rows on %d pages at %.2fpt\n", len(art.Cells), len(contents), fontSize)
+	}
+
+	return writePDF(contents, pageWidth, pageHeight), nil
+}
+
+func writePDF(contents [][]byte, pageWidth, pageHeight float64) []byte {
+	result := &bytes.Buffer{}
+	offsets := make([]int, 0)
+	object := func(body string) {
+		offsets = append(offsets, result.Len())
+
+		fmt.Fprintf(result, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	result.WriteString("%PDF-1.4\n")
+
+	kids := &bytes.Buffer{}
+
+	for i := range contents {
+		fmt.Fprintf(kids, "%d 0 R ", 4+i*2)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(contents)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range contents {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 5+i*2))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content))
+	}
+
+	xref := result.Len()
+
+	fmt.Fprintf(result, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+
+	for _, offset := range offsets {
+		fmt.Fprintf(result, "%010d 00000 n \n", offset)
+	}
+
+	fmt.Fprintf(result, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return result.Bytes()
+}
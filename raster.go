@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+var rasterFace = basicfont.Face7x13
+
+// blockMask describes a block character as a grid of Columns×Rows parts,
+// of which those with their bit set in Mask are filled, bits running left to
+// right and then top to bottom.
+type blockMask struct {
+	Columns, Rows, Mask int
+}
+
+// rasterBlocks holds the block characters the mapping modes use, which the
+// embedded font has no glyphs for, so they are drawn as rectangles instead.
+var rasterBlocks = func() map[rune]blockMask {
+	blocks := map[rune]blockMask{
+		upperHalfBlock: {1, 2, 1},
+		'▄':            {1, 2, 2},
+		'▔':            {1, 8, 1},
+		'▁':            {1, 8, 1 << 7},
+		'▕':            {8, 1, 1 << 7},
+		'▏':            {8, 1, 1},
+	}
+
+	for mask, char := range quadrantGlyphs {
+		blocks[char] = blockMask{2, 2, mask}
+	}
+
+	for mask := 0; mask < 64; mask++ {
+		blocks[sextantGlyph(mask)] = blockMask{2, 3, mask}
+	}
+
+	return blocks
+}()
+
+// rasterShades are the shade characters, drawn as the foreground mixed this
+// far into the background.
+var rasterShades = map[rune]float64{
+	'░': 0.25,
+	'▒': 0.5,
+	'▓': 0.75,
+}
+
+// drawBlock draws a block, shade or braille character as rectangles filling
+// the cell, returning false for any other character.
+func drawBlock(img *image.NRGBA, cell image.Rectangle, char rune, foreground color.NRGBA) bool {
+	fill := image.NewUniform(foreground)
+	width, height := cell.Dx(), cell.Dy()
+	part := func(x0, y0, x1, y1, columns, rows int) image.Rectangle {
+		return image.Rect(cell.Min.X+x0*width/columns, cell.Min.Y+y0*height/rows, cell.Min.X+x1*width/columns, cell.Min.Y+y1*height/rows)
+	}
+
+	if block, ok := rasterBlocks[char]; ok {
+		for i := 0; i < block.Columns*block.Rows; i++ {
+			if block.Mask&(1<<uint(i)) != 0 {
+				x, y := i%block.Columns, i/block.Columns
+
+				draw.Draw(img, part(x, y, x+1, y+1, block.Columns, block.Rows), fill, image.Point{}, draw.Src)
+			}
+		}
+
+		return true
+	}
+
+	if share, ok := rasterShades[char]; ok {
+		alpha := color.NRGBA{A: uint8(share * 255)}
+
+		draw.DrawMask(img, cell, fill, image.Point{}, image.NewUniform(alpha), image.Point{}, draw.Over)
+
+		return true
+	}
+
+	// Braille dots 1 to 6 run down the left and then the right column, and
+	// dots 7 and 8 are added below them.
+	if char >= 0x2800 && char <= 0x28ff {
+		dots := [8]image.Point{{0, 0}, {0, 1}, {0, 2}, {1, 0}, {1, 1}, {1, 2}, {0, 3}, {1, 3}}
+
+		for i, dot := range dots {
+			if (char-0x2800)&(1<<uint(i)) != 0 {
+				r := part(dot.X, dot.Y, dot.X+1, dot.Y+1, 2, 4)
+				inset := r.Dx() / 4
+
+				draw.Draw(img, r.Inset(inset), fill, image.Point{}, draw.Src)
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// rasterize draws the art into an image using an embedded bitmap font, one
+// glyph per cell. Wide characters take two cells.
+func rasterize(art Art, opts *Options) (*image.NRGBA, error) {
+	foreground, err := parseHexColor(opts.ImageForeground)
+
+	if err != nil {
+		return nil, fmt.Errorf("--image-foreground: %w", err)
+	}
+
+	background, err := parseHexColor(opts.ImageBackground)
+
+	if err != nil {
+		return nil, fmt.Errorf("--image-background: %w", err)
+	}
+
+	columns := artColumns(art)
+	cellWidth, cellHeight := rasterFace.Advance, rasterFace.Height
+	img := image.NewNRGBA(image.Rect(0, 0, columns*cellWidth, len(art.Cells)*cellHeight))
+
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	colored := colorEnabled(opts)
+	drawer := &font.Drawer{Dst: img, Src: image.NewUniform(foreground), Face: rasterFace}
+
+	for y, row := range art.Cells {
+		x := 0
+
+		for _, cell := range row {
+			columns := runeColumns(cell.Char)
+			bounds := image.Rect(x*cellWidth, y*cellHeight, (x+columns)*cellWidth, (y+1)*cellHeight)
+			ink := foreground
+
+			if colored && !cell.Plain {
+				ink = displayColor(cell, opts)
+
+				if cell.Background != nil {
+					draw.Draw(img, bounds, image.NewUniform(paletteColor(*cell.Background, luminance(*cell.Background, opts.LumaFormula), opts)), image.Point{}, draw.Src)
+				}
+			}
+
+			if !drawBlock(img, bounds, cell.Char, ink) {
+				drawer.Src = image.NewUniform(ink)
+				drawer.Dot = fixed.P(x*cellWidth, y*cellHeight+rasterFace.Ascent)
+				drawer.DrawString(string(cell.Char))
+			}
+
+			x += columns
+		}
+	}
+
+	return img, nil
+}
+
+func renderPNG(art Art, opts *Options) ([]byte, error) {
+	img, err := rasterize(art, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Verbose {
+		fmt.Printf("VERBOSE: Rendered %dx%d PNG image\n", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+
+	result := &bytes.Buffer{}
+
+	if err = png.Encode(result, img); err != nil {
+		return nil, err
+	}
+
+	return result.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+var rawChannels = map[string]int{
+	"gray": 1,
+	"rgb":  3,
+	"bgr":  3,
+	"rgba": 4,
+	"bgra": 4,
+}
+
+type rawSpec struct {
+	Width  int
+	Height int
+	Format string
+}
+
+func parseRawSpec(value string) (*rawSpec, error) {
+	spec := &rawSpec{Format: "rgba"}
+	dimensions := value
+
+	if i := strings.Index(value, ":"); i >= 0 {
+		dimensions = value[:i]
+		spec.Format = strings.ToLower(value[i+1:])
+	}
+
+	if _, ok := rawChannels[spec.Format]; !ok {
+		return nil, fmt.Errorf("unknown raw pixel format: %s", spec.Format)
+	}
+
+	split := strings.SplitN(dimensions, "x", 2)
+
+	if len(split) < 2 {
+		return nil, fmt.Errorf("invalid raw dimensions: %s", dimensions)
+	}
+
+	width, err := strconv.ParseUint(split[0], 10, 16)
+
+	if err != nil || width < 1 {
+		return nil, fmt.Errorf("invalid raw width: %s", split[0])
+	}
+
+	height, err := strconv.ParseUint(split[1], 10, 16)
+
+	if err != nil || height < 1 {
+		return nil, fmt.Errorf("invalid raw height: %s", split[1])
+	}
+
+	spec.Width = int(width)
+	spec.Height = int(height)
+
+	return spec, nil
+}
+
+func decodeRaw(data []byte, spec *rawSpec) (image.Image, error) {
+	channels := rawChannels[spec.Format]
+	expected := spec.Width * spec.Height * channels
+
+	if len(data) != expected {
+		return nil, fmt.Errorf("raw input is %d bytes but %dx%d %s pixels require exactly %d bytes (%d per pixel)", len(data), spec.Width, spec.Height, spec.Format, expected, channels)
+	}
+
+	bounds := image.Rect(0, 0, spec.Width, spec.Height)
+
+	if spec.Format == "gray" {
+		img := image.NewGray(bounds)
+
+		copy(img.Pix, data)
+
+		return img, nil
+	}
+
+	img := image.NewNRGBA(bounds)
+
+	for i := 0; i < spec.Width*spec.Height; i++ {
+		pixel := data[i*channels : (i+1)*channels]
+		r, g, b, a := pixel[0], pixel[1], pixel[2], uint8(255)
+
+		if strings.HasPrefix(spec.Format, "bgr") {
+			r, b = b, r
+		}
+
+		if channels == 4 {
+			a = pixel[3]
+		}
+
+		copy(img.Pix[i*4:], []uint8{r, g, b, a})
+	}
+
+	return img, nil
+}
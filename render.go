@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+const ansiReset = "\x1b[0m"
+
+var formatExtensions = map[string]string{
+	"text":     ".txt",
+	"html":     ".html",
+	"svg":      ".svg",
+	"png":      ".png",
+	"pdf":      ".pdf",
+	"json":     ".json",
+	"latex":    ".tex",
+	"markdown": ".md",
+	"irc":      ".irc",
+	"ans":      ".ans",
+	"go":       ".go",
+	"c":        ".c",
+	"cast":     ".cast",
+}
+
+func colorEnabled(opts *Options) bool {
+	return opts.Color != "none" && opts.Color != "never"
+}
+
+// colorCode returns the SGR parameters selecting c as the foreground color,
+// or as the background color when background is set.
+func colorCode(c color.NRGBA, lum float64, background bool, opts *Options) string {
+	offset := 0
+
+	if background {
+		offset = 10
+	}
+
+	switch opts.Color {
+	case "ansi16":
+		return strconv.Itoa(ansi16Code(nearestANSI16(c, opts.Match)) + offset)
+	case "ansi256":
+		return fmt.Sprintf("%d;5;%d", 38+offset, nearestANSI256(c, opts.Match))
+	case "gray":
+		return fmt.Sprintf("%d;5;%d", 38+offset, grayRampIndex(lum))
+	case "truecolor":
+		return fmt.Sprintf("%d;2;%d;%d;%d", 38+offset, c.R, c.G, c.B)
+	}
+
+	return ""
+}
+
+// cellCodes returns the SGR parameters for the foreground and background of
+// a cell, empty where the terminal default is kept.
+func cellCodes(cell Cell, opts *Options) (string, string) {
+	if cell.Plain {
+		return "", ""
+	}
+
+	if cell.Background != nil {
+		return colorCode(cell.Color, luminance(cell.Color, opts.LumaFormula), false, opts), colorCode(*cell.Background, luminance(*cell.Background, opts.LumaFormula), true, opts)
+	}
+
+	// The odd last row of --mode=halfblock only has its top pixel, which the
+	// half block draws whatever --color-target says, leaving the bottom half
+	// to the terminal background.
+	if opts.Mode == "halfblock" {
+		return colorCode(cell.Color, cell.Lum, false, opts), ""
+	}
+
+	switch opts.ColorTarget {
+	case "bg":
+		return "", colorCode(cell.Color, cell.Lum, true, opts)
+	case "both":
+		contrast, contrastLum := color.NRGBA{255, 255, 255, 255}, 1.0
+
+		if luminance(displayColor(cell, opts), opts.LumaFormula) >= 0.5 {
+			contrast, contrastLum = color.NRGBA{0, 0, 0, 255}, 0
+		}
+
+		return colorCode(contrast, contrastLum, false, opts), colorCode(cell.Color, cell.Lum, true, opts)
+	}
+
+	return colorCode(cell.Color, cell.Lum, false, opts), ""
+}
+
+func paletteColor(c color.NRGBA, lum float64, opts *Options) color.NRGBA {
+	switch opts.Color {
+	case "ansi16":
+		return ansi16Palette[nearestANSI16(c, opts.Match)]
+	case "ansi256":
+		return ansi256Color(nearestANSI256(c, opts.Match))
+	case "gray":
+		return ansi256Color(grayRampIndex(lum))
+	}
+
+	return color.NRGBA{c.R, c.G, c.B, 255}
+}
+
+// displayColor returns the color a cell is shown in under the active color
+// mode, for formats that describe colors directly rather than with escapes.
+func displayColor(cell Cell, opts *Options) color.NRGBA {
+	return paletteColor(cell.Color, cell.Lum, opts)
+}
+
+func artWidth(art Art) int {
+	width := 0
+
+	for _, row := range art.Cells {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	return width
+}
+
+func render(art Art, opts *Options) ([]byte, error) {
+	switch opts.Format {
+	case "html":
+		return renderHTML(art, opts)
+	case "svg":
+		return renderSVG(art, opts)
+	case "png":
+		return renderPNG(art, opts)
+	case "pdf":
+		return renderPDF(art, opts)
+	case "json":
+		return renderJSON(art, opts)
+	case "latex":
+		return renderLaTeX(art, opts)
+	case "markdown":
+		return renderMarkdown(art, opts)
+	case "irc":
+		return renderIRC(art, opts)
+	case "ans":
+		return renderANS(art, opts)
+	case "go", "c":
+		return renderSource(art, opts)
+	}
+
+	return renderText(art, opts), nil
+}
+
+// renderArts renders each frame separately, except for formats that hold a
+// whole animation in one output.
+func renderArts(arts []Art, opts *Options) ([][]byte, error) {
+	if opts.Format == "cast" {
+		output, err := renderCast(arts, opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return [][]byte{output}, nil
+	}
+
+	outputs := make([][]byte, 0, len(arts))
+
+	for _, art := range arts {
+		output, err := render(art, opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		outputs = append(outputs, output)
+	}
+
+	return outputs, nil
+}
+
+// sgrOrDefault returns the SGR parameters, or the code restoring the
+// terminal default when they are empty.
+func sgrOrDefault(params, fallback string) string {
+	if len(params) < 1 {
+		return fallback
+	}
+
+	return params
+}
+
+func renderText(art Art, opts *Options) []byte {
+	result := &bytes.Buffer{}
+	colored := colorEnabled(opts)
+
+	for y, row := range art.Cells {
+		// The current colors are empty for the terminal defaults, as
+		// cellCodes returns them, and only written out as 39 and 49.
+		currentFg, currentBg := "", ""
+		styled := false
+
+		for _, cell := range row {
+			if colored {
+				fg, bg := cellCodes(cell, opts)
+				params := make([]string, 0, 2)
+
+				// The foreground does not show on plain filler, so it is
+				// kept rather than reset.
+				if cell.Plain {
+					fg = currentFg
+				}
+
+				if fg != currentFg {
+					params = append(params, sgrOrDefault(fg, "39"))
+				}
+
+				if bg != currentBg {
+					params = append(params, sgrOrDefault(bg, "49"))
+				}
+
+				if len(params) > 0 {
+					result.WriteString("\x1b[" + strings.Join(params, ";") + "m")
+					styled = true
+				}
+
+				currentFg, currentBg = fg, bg
+			}
+
+			result.WriteRune(cell.Char)
+		}
+
+		if styled {
+			result.WriteString(ansiReset)
+		}
+
+		if y+1 != len(art.Cells) {
+			result.WriteString("\n")
+		}
+	}
+
+	return result.Bytes()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// styledChar is a character as a terminal shows it, with the SGR parameters
+// of its colors.
+type styledChar struct {
+	Char rune
+	Fg   string
+	Bg   string
+}
+
+// screen interprets the SGR sequences of colored output, returning what the
+// terminal would show for every line and the number of sequences before the
+// end of a line that change nothing.
+func screen(output string) ([][]styledChar, int) {
+	var lines [][]styledChar
+	redundant := 0
+
+	for _, line := range strings.Split(output, "\n") {
+		var chars []styledChar
+		fg, bg := "", ""
+
+		for len(line) > 0 {
+			if strings.HasPrefix(line, "\x1b[") {
+				end := strings.IndexByte(line, 'm')
+				params := strings.Split(line[2:end], ";")
+				line = line[end+1:]
+				previousFg, previousBg := fg, bg
+
+				for i := 0; i < len(params); i++ {
+					switch p := params[i]; {
+					case p == "0":
+						fg, bg = "", ""
+					case p == "39":
+						fg = ""
+					case p == "49":
+						bg = ""
+					case p == "38" || p == "48":
+						length := 3
+
+						if params[i+1] == "2" {
+							length = 5
+						}
+
+						if p == "38" {
+							fg = strings.Join(params[i:i+length], ";")
+						} else {
+							bg = strings.Join(params[i:i+length], ";")
+						}
+
+						i += length - 1
+					case p >= "30" && p <= "37", p >= "90" && p <= "97":
+						fg = p
+					case p >= "40" && p <= "47", p >= "100" && p <= "107":
+						bg = p
+					}
+				}
+
+				if fg == previousFg && bg == previousBg && len(line) > 0 {
+					redundant++
+				}
+
+				continue
+			}
+
+			// The foreground of a space does not show.
+			char := []rune(line)[0]
+			shown := styledChar{char, fg, bg}
+
+			if char == ' ' {
+				shown.Fg = ""
+			}
+
+			chars = append(chars, shown)
+			line = line[len(string(char)):]
+		}
+
+		lines = append(lines, chars)
+	}
+
+	return lines, redundant
+}
+
+// naiveRender writes every cell with the full escape sequence of its colors.
+func naiveRender(art Art, opts *Options) string {
+	result := &strings.Builder{}
+
+	for y, row := range art.Cells {
+		for _, cell := range row {
+			fg, bg := cellCodes(cell, opts)
+
+			if len(fg) < 1 {
+				fg = "39"
+			}
+
+			if len(bg) < 1 {
+				bg = "49"
+			}
+
+			result.WriteString("\x1b[" + fg + ";" + bg + "m" + string(cell.Char))
+		}
+
+		result.WriteString(ansiReset)
+
+		if y+1 != len(art.Cells) {
+			result.WriteString("\n")
+		}
+	}
+
+	return result.String()
+}
+
+func TestRenderSuppressesEscapes(t *testing.T) {
+	flat := image.NewNRGBA(image.Rect(0, 0, 200, 60))
+	noisy := image.NewNRGBA(image.Rect(0, 0, 200, 60))
+	holes := image.NewNRGBA(image.Rect(0, 0, 200, 60))
+
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 200; x++ {
+			flat.SetNRGBA(x, y, color.NRGBA{200, 80, 40, 255})
+			noisy.SetNRGBA(x, y, color.NRGBA{uint8(200 + x%3), uint8(80 + y%3), 40, 255})
+
+			if x%50 >= 20 {
+				holes.SetNRGBA(x, y, color.NRGBA{200, 80, 40, 255})
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		img    image.Image
+		args   []string
+		factor int
+	}{
+		{"truecolor", flat, []string{"-r", "200x60", "--color", "truecolor"}, 10},
+		{"ansi256", flat, []string{"-r", "200x60", "--color", "ansi256"}, 10},
+		{"ansi16", flat, []string{"-r", "200x60", "--color", "ansi16"}, 3},
+		{"background", flat, []string{"-r", "200x60", "--color", "truecolor", "--color-target", "bg"}, 10},
+		{"halfblock", flat, []string{"-r", "200x60", "--color", "truecolor", "--mode", "halfblock"}, 10},
+		// Rounding the channels merges the slightly different colors.
+		{"quantized", noisy, []string{"-r", "200x60", "--color", "truecolor", "--color-quantize", "4"}, 10},
+		// Padding and blank cells are plain, leaving the terminal default
+		// background without an escape for each of them.
+		{"background canvas", flat, []string{"--canvas", "400x20", "--color", "truecolor", "--color-target", "bg"}, 10},
+		{"both canvas", flat, []string{"--canvas", "400x20", "--color", "truecolor", "--color-target", "both"}, 10},
+		{"background blank", holes, []string{"-r", "200x60", "--color", "truecolor", "--color-target", "bg", "--transparent", "blank"}, 5},
+		{"both blank", holes, []string{"-r", "200x60", "--color", "truecolor", "--color-target", "both", "--transparent", "blank"}, 5},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts := testOptions(t, test.args...)
+			art := convertImage(t, test.img, test.args...)
+			output := string(renderText(art, opts))
+			naive := naiveRender(art, opts)
+
+			if len(output)*test.factor > len(naive) {
+				t.Errorf("output is %d bytes, want at most 1/%d of the %d bytes of an escape per cell", len(output), test.factor, len(naive))
+			}
+
+			got, redundant := screen(output)
+
+			if want, _ := screen(naive); !reflect.DeepEqual(got, want) {
+				t.Error("output does not show the same as an escape per cell")
+			}
+
+			if redundant > 0 {
+				t.Errorf("output has %d escape sequences that change nothing", redundant)
+			}
+
+			for i, line := range strings.Split(output, "\n") {
+				if strings.Contains(line, "\x1b[") && !strings.HasSuffix(line, ansiReset) {
+					t.Fatalf("line %d does not end with a reset", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+var resizeFilters = map[string]bool{
+	"auto":     true,
+	"nearest":  true,
+	"bilinear": true,
+	"bicubic":  true,
+	"lanczos":  true,
+	"area":     true,
+}
+
+// resizeFilter resolves --filter=auto, which averages areas when shrinking
+// by more than half along either axis, and otherwise picks the nearest pixel.
+func resizeFilter(filter string, img image.Image, width, height int) string {
+	if filter != "auto" {
+		return filter
+	}
+
+	if size := img.Bounds().Size(); size.X > width*2 || size.Y > height*2 {
+		return "area"
+	}
+
+	return "nearest"
+}
+
+// resize scales the image to width×height with the given --filter, which
+// must have been resolved by resizeFilter.
+func resize(img image.Image, width, height int, filter string) image.Image {
+	size := img.Bounds().Size()
+
+	switch filter {
+	case "bilinear":
+		return resizeBilinear(img, width, height)
+	case "area":
+		return resizeSeparable(img, width, height, areaWeights(width, size.X), areaWeights(height, size.Y))
+	}
+
+	if k, ok := resampleKernels[filter]; ok {
+		return resizeSeparable(img, width, height, kernelWeights(width, size.X, k), kernelWeights(height, size.Y, k))
+	}
+
+	output := image.NewNRGBA(image.Rect(0, 0, width, height))
+	origin := img.Bounds().Min
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			ix := int((float64(x) / float64(width)) * float64(size.X))
+			iy := int((float64(y) / float64(height)) * float64(size.Y))
+
+			output.Set(x, y, img.At(origin.X+ix, origin.Y+iy))
+		}
+	}
+
+	return output
+}
+
+// sourceTaps returns the two source pixels either side of the centre of
+// destination pixel i, clamped to the edge, and the weight of the second.
+func sourceTaps(i, destination, source int) (int, int, float64) {
+	position := (float64(i)+0.5)*float64(source)/float64(destination) - 0.5
+	first := int(math.Floor(position))
+	weight := position - float64(first)
+	second := first + 1
+
+	if first < 0 {
+		first = 0
+	}
+
+	if second > source-1 {
+		second = source - 1
+	}
+
+	if first > source-1 {
+		first = source - 1
+	}
+
+	return first, second, weight
+}
+
+// resizeBilinear weighs the four source pixels around every destination
+// pixel. Colors are mixed premultiplied, so transparent pixels do not darken
+// the edges of opaque ones.
+func resizeBilinear(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	size := bounds.Size()
+	output := image.NewRGBA64(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1, wy := sourceTaps(y, height, size.Y)
+
+		for x := 0; x < width; x++ {
+			x0, x1, wx := sourceTaps(x, width, size.X)
+			var sum [4]float64
+
+			for _, tap := range [4]struct {
+				x, y   int
+				weight float64
+			}{
+				{x0, y0, (1 - wx) * (1 - wy)},
+				{x1, y0, wx * (1 - wy)},
+				{x0, y1, (1 - wx) * wy},
+				{x1, y1, wx * wy},
+			} {
+				r, g, b, a := img.At(bounds.Min.X+tap.x, bounds.Min.Y+tap.y).RGBA()
+
+				sum[0] += float64(r) * tap.weight
+				sum[1] += float64(g) * tap.weight
+				sum[2] += float64(b) * tap.weight
+				sum[3] += float64(a) * tap.weight
+			}
+
+			output.SetRGBA64(x, y, color.RGBA64{uint16(sum[0] + 0.5), uint16(sum[1] + 0.5), uint16(sum[2] + 0.5), uint16(sum[3] + 0.5)})
+		}
+	}
+
+	return output
+}
+
+// resampleKernel is a filter for resizeSeparable, weighing source pixels by
+// their distance from the sample point, zero beyond the radius.
+type resampleKernel struct {
+	Radius float64
+	Weight func(distance float64) float64
+}
+
+var resampleKernels = map[string]resampleKernel{
+	"bicubic": {2, catmullRom},
+	"lanczos": {3, lanczos3},
+}
+
+// catmullRom is the bicubic kernel with a = -0.5, which keeps edges sharp.
+func catmullRom(distance float64) float64 {
+	distance = math.Abs(distance)
+
+	switch {
+	case distance < 1:
+		return 1.5*distance*distance*distance - 2.5*distance*distance + 1
+	case distance < 2:
+		return -0.5*distance*distance*distance + 2.5*distance*distance - 4*distance + 2
+	}
+
+	return 0
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// lanczos3 is a sinc windowed by a sinc three times as wide.
+func lanczos3(distance float64) float64 {
+	if math.Abs(distance) >= 3 {
+		return 0
+	}
+
+	return sinc(distance) * sinc(distance/3)
+}
+
+// kernelTaps are the source pixels and normalized weights that make up one
+// destination pixel.
+type kernelTaps struct {
+	Indices []int
+	Weights []float64
+}
+
+// kernelWeights precomputes the taps of every destination pixel along one
+// axis. When shrinking, the kernel is stretched to cover every source pixel
+// that falls into the destination pixel. Taps past the edge are clamped to
+// the edge pixel.
+func kernelWeights(destination, source int, k resampleKernel) []kernelTaps {
+	ratio := float64(source) / float64(destination)
+	stretch := math.Max(ratio, 1)
+	radius := k.Radius * stretch
+	taps := make([]kernelTaps, destination)
+
+	for i := range taps {
+		center := (float64(i)+0.5)*ratio - 0.5
+		total := 0.0
+
+		for j := int(math.Ceil(center - radius)); j <= int(math.Floor(center+radius)); j++ {
+			weight := k.Weight((float64(j) - center) / stretch)
+
+			if weight == 0 {
+				continue
+			}
+
+			index := j
+
+			if index < 0 {
+				index = 0
+			} else if index > source-1 {
+				index = source - 1
+			}
+
+			taps[i].Indices = append(taps[i].Indices, index)
+			taps[i].Weights = append(taps[i].Weights, weight)
+			total += weight
+		}
+
+		for j := range taps[i].Weights {
+			taps[i].Weights[j] /= total
+		}
+	}
+
+	return taps
+}
+
+// areaWeights weighs every source pixel by how much of it the destination
+// pixel covers, including the partly covered pixels at either end, so that
+// the destination is the exact average of its area.
+func areaWeights(destination, source int) []kernelTaps {
+	ratio := float64(source) / float64(destination)
+	taps := make([]kernelTaps, destination)
+
+	for i := range taps {
+		start, end := float64(i)*ratio, float64(i+1)*ratio
+
+		for j := int(start); j < source && float64(j) < end; j++ {
+			weight := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+
+			if weight <= 0 {
+				continue
+			}
+
+			taps[i].Indices = append(taps[i].Indices, j)
+			taps[i].Weights = append(taps[i].Weights, weight/ratio)
+		}
+	}
+
+	return taps
+}
+
+// resizeSeparable resizes with precomputed taps as a horizontal pass over
+// each source row followed by a vertical pass, in premultiplied color.
+// Kernels with negative lobes overshoot at hard edges, so the result is
+// clamped to valid colors.
+func resizeSeparable(img image.Image, width, height int, columns, rows []kernelTaps) image.Image {
+	bounds := img.Bounds()
+	size := bounds.Size()
+	horizontal := make([]float32, width*size.Y*4)
+	row := make([]float32, size.X*4)
+
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+
+			row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = float32(r), float32(g), float32(b), float32(a)
+		}
+
+		for x, taps := range columns {
+			out := horizontal[(y*width+x)*4:]
+
+			for t, index := range taps.Indices {
+				weight := float32(taps.Weights[t])
+
+				for c := 0; c < 4; c++ {
+					out[c] += row[index*4+c] * weight
+				}
+			}
+		}
+	}
+
+	output := image.NewRGBA64(image.Rect(0, 0, width, height))
+
+	for y, taps := range rows {
+		for x := 0; x < width; x++ {
+			var sum [4]float32
+
+			for t, index := range taps.Indices {
+				weight := float32(taps.Weights[t])
+				in := horizontal[(index*width+x)*4:]
+
+				for c := 0; c < 4; c++ {
+					sum[c] += in[c] * weight
+				}
+			}
+
+			alpha := clampChannel(sum[3], math.MaxUint16)
+
+			output.SetRGBA64(x, y, color.RGBA64{clampChannel(sum[0], alpha), clampChannel(sum[1], alpha), clampChannel(sum[2], alpha), alpha})
+		}
+	}
+
+	return output
+}
+
+// clampChannel rounds a premultiplied channel into 0 to limit, the alpha of
+// the pixel for colors.
+func clampChannel(value float32, limit uint16) uint16 {
+	if value <= 0 {
+		return 0
+	}
+
+	if value >= float32(limit) {
+		return limit
+	}
+
+	return uint16(value + 0.5)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// BenchmarkResize shrinks a 4000 pixel wide source to a typical terminal
+// width with every filter.
+func BenchmarkResize(b *testing.B) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4000, 3000))
+
+	for y := 0; y < 3000; y++ {
+		for x := 0; x < 4000; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x ^ y), uint8(x * y >> 8), uint8(x + y), 255})
+		}
+	}
+
+	for _, filter := range []string{"nearest", "bilinear", "bicubic", "lanczos", "area"} {
+		b.Run(filter, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				resize(img, 160, 60, filter)
+			}
+		})
+	}
+}
+
+func TestResizeBicubicClamped(t *testing.T) {
+	// A hard edge makes the negative lobes of the kernel ring.
+	img := grayImage(8, 1, func(x, y int) uint8 {
+		if x < 4 {
+			return 0
+		}
+
+		return 255
+	})
+
+	// Unclamped, the ringing would wrap around and put bright pixels on the
+	// dark side, so the edge must rise without ever falling.
+	result := resize(img, 23, 1, "bicubic")
+	previous := 0.0
+
+	for x := 0; x < 23; x++ {
+		lum := luminance(result.At(x, 0), nil)
+
+		if lum < previous {
+			t.Errorf("luminance falls from %g to %g at %d", previous, lum, x)
+		}
+
+		previous = lum
+	}
+}
+
+func TestResizeAreaCheckerboard(t *testing.T) {
+	img := grayImage(100, 100, func(x, y int) uint8 { return uint8((x + y) % 2 * 255) })
+
+	if filter := resizeFilter("auto", img, 10, 10); filter != "area" {
+		t.Fatalf("resizeFilter = %q, want area", filter)
+	}
+
+	// Every pixel the nearest filter picks has the same parity, so it sees
+	// a solid tone.
+	if lum := luminance(resize(img, 10, 10, "nearest").At(3, 3), nil); lum > 0 && lum < 1 {
+		t.Fatalf("nearest filter luminance is %g, the fixture no longer collapses", lum)
+	}
+
+	art := convertImage(t, img, "-r", "10x10")
+
+	for y, row := range art.Cells {
+		for x, cell := range row {
+			if cell.Lum < 0.45 || cell.Lum > 0.55 {
+				t.Fatalf("luminance of cell %d,%d is %g, want about 0.5", x, y, cell.Lum)
+			}
+		}
+	}
+}
+
+func TestResizeAreaPartialPixels(t *testing.T) {
+	// Each destination pixel covers one and a half source pixels.
+	img := grayImage(3, 1, func(x, y int) uint8 { return uint8(x % 2 * 255) })
+	result := resize(img, 2, 1, "area")
+
+	for x := 0; x < 2; x++ {
+		if gray := color.GrayModel.Convert(result.At(x, 0)).(color.Gray).Y; gray < 84 || gray > 86 {
+			t.Errorf("pixel %d is %d, want 85", x, gray)
+		}
+	}
+}
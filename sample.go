@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// sampleStatistics are the --sample values besides mean, each picking one
+// pixel out of the pixels a cell covers, ordered by luminance.
+var sampleStatistics = map[string]func(count int) int{
+	"min":    func(count int) int { return 0 },
+	"median": func(count int) int { return count / 2 },
+	"max":    func(count int) int { return count - 1 },
+}
+
+// checkSample validates --sample.
+func checkSample(opts *Options) error {
+	if _, ok := sampleStatistics[opts.Sample]; !ok && len(opts.Sample) > 0 && opts.Sample != "mean" {
+		return fmt.Errorf("invalid --sample: %s", opts.Sample)
+	}
+
+	return nil
+}
+
+// sampleSpan returns the source pixels output pixel i of destination covers,
+// at least one.
+func sampleSpan(i, destination, source int) (int, int) {
+	start := i * source / destination
+	end := ((i+1)*source + destination - 1) / destination
+
+	if end <= start {
+		end = start + 1
+	}
+
+	return start, end
+}
+
+// sample gives every output pixel the pixel the statistic picks out of the
+// source pixels it covers, so a thin bright line survives as the max rather
+// than being averaged away, and the median drops isolated noise. The mean is
+// the area filter, which weighs pixels that are only partly covered by the
+// area they cover.
+func sample(img image.Image, width, height int, statistic string, opts *Options) image.Image {
+	if statistic == "mean" {
+		if opts.LinearResize {
+			return resizeLinear(img, width, height, "area")
+		}
+
+		return resize(img, width, height, "area")
+	}
+
+	pick := sampleStatistics[statistic]
+	bounds := img.Bounds()
+	output := image.NewNRGBA64(image.Rect(0, 0, width, height))
+
+	type candidate struct {
+		X, Y int
+		Lum  float64
+	}
+
+	candidates := make([]candidate, 0)
+
+	for y := 0; y < height; y++ {
+		y0, y1 := sampleSpan(y, height, bounds.Dy())
+
+		for x := 0; x < width; x++ {
+			x0, x1 := sampleSpan(x, width, bounds.Dx())
+			candidates = candidates[:0]
+
+			for sy := bounds.Min.Y + y0; sy < bounds.Min.Y+y1; sy++ {
+				for sx := bounds.Min.X + x0; sx < bounds.Min.X+x1; sx++ {
+					candidates = append(candidates, candidate{sx, sy, luminance(img.At(sx, sy), opts.LumaFormula)})
+				}
+			}
+
+			sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Lum < candidates[j].Lum })
+
+			chosen := candidates[pick(len(candidates))]
+
+			output.Set(x, y, img.At(chosen.X, chosen.Y))
+		}
+	}
+
+	return output
+}
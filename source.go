@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sourceChunkSize bounds the bytes of art held by one string literal, well
+// under the limits of common compilers.
+const sourceChunkSize = 256
+
+var cIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sourceChunks splits the text output into rows, keeping each newline with
+// the row it ends, and splits long rows further.
+func sourceChunks(text string) []string {
+	chunks := make([]string, 0)
+
+	for len(text) > 0 {
+		end := strings.IndexByte(text, '\n') + 1
+
+		if end < 1 {
+			end = len(text)
+		}
+
+		if end > sourceChunkSize {
+			end = sourceChunkSize
+
+			// Never split a multi-byte character across literals.
+			for end > 0 && text[end]&0xc0 == 0x80 {
+				end--
+			}
+		}
+
+		chunks = append(chunks, text[:end])
+		text = text[end:]
+	}
+
+	if len(chunks) < 1 {
+		chunks = append(chunks, "")
+	}
+
+	return chunks
+}
+
+func quoteC(value string) string {
+	result := &strings.Builder{}
+
+	result.WriteByte('"')
+
+	for i := 0; i < len(value); i++ {
+		switch b := value[i]; {
+		case b == '\\' || b == '"':
+			result.WriteByte('\\')
+			result.WriteByte(b)
+		case b == '\n':
+			result.WriteString("\\n")
+		case b == '?' && i > 0 && value[i-1] == '?':
+			// Avoid forming trigraphs such as ??/ with the previous character.
+			result.WriteString("\\?")
+		case b < 0x20 || b >= 0x7f:
+			fmt.Fprintf(result, "\\%03o", b)
+		default:
+			result.WriteByte(b)
+		}
+	}
+
+	result.WriteByte('"')
+
+	return result.String()
+}
+
+func renderSource(art Art, opts *Options) ([]byte, error) {
+	result := &bytes.Buffer{}
+	chunks := sourceChunks(string(renderText(art, opts)) + "\n")
+
+	if opts.Format == "go" {
+		if !token.IsIdentifier(opts.SourceName) {
+			return nil, fmt.Errorf("invalid Go identifier: %s", opts.SourceName)
+		}
+
+		if !token.IsIdentifier(opts.SourcePackage) {
+			return nil, fmt.Errorf("invalid Go package name: %s", opts.SourcePackage)
+		}
+
+		fmt.Fprintf(result, "package %s\n\nconst %s = ", opts.SourcePackage, opts.SourceName)
+
+		for i, chunk := range chunks {
+			if i > 0 {
+				result.WriteString(" +\n\t")
+			}
+
+			result.WriteString(strconv.QuoteToASCII(chunk))
+		}
+
+		result.WriteString("\n")
+
+		return result.Bytes(), nil
+	}
+
+	if !cIdentifier.MatchString(opts.SourceName) {
+		return nil, fmt.Errorf("invalid C identifier: %s", opts.SourceName)
+	}
+
+	fmt.Fprintf(result, "const char %s[] =", opts.SourceName)
+
+	for _, chunk := range chunks {
+		result.WriteString("\n\t")
+		result.WriteString(quoteC(chunk))
+	}
+
+	result.WriteString(";\n")
+
+	return result.Bytes(), nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+)
+
+const (
+	svgFontSize   = 10.0
+	svgCellWidth  = svgFontSize * 0.6
+	svgCellHeight = svgFontSize
+)
+
+func escapeXML(value string) string {
+	result := &bytes.Buffer{}
+
+	xml.EscapeText(result, []byte(value))
+
+	return result.String()
+}
+
+// writeSVGBackgrounds draws a rectangle behind every run of cells sharing a
+// background color, such as the bottom pixels of --mode=halfblock.
+func writeSVGBackgrounds(result *bytes.Buffer, art Art, opts *Options) {
+	fill := func(cell Cell) (color.NRGBA, bool) {
+		if cell.Background == nil {
+			return color.NRGBA{}, false
+		}
+
+		return paletteColor(*cell.Background, luminance(*cell.Background, opts.LumaFormula), opts), true
+	}
+
+	for y, row := range art.Cells {
+		column := 0
+
+		for x := 0; x < len(row); {
+			start := column
+			c, filled := fill(row[x])
+
+			for ; x < len(row); x++ {
+				if next, nextFilled := fill(row[x]); next != c || nextFilled != filled {
+					break
+				}
+
+				column += runeColumns(row[x].Char)
+			}
+
+			if filled {
+				fmt.Fprintf(result, "<rect x=\"%g\" y=\"%g\" width=\"%g\" height=\"%g\" fill=\"%s\"/>\n", float64(start)*svgCellWidth, float64(y)*svgCellHeight, float64(column-start)*svgCellWidth, svgCellHeight, hexColor(c))
+			}
+		}
+	}
+}
+
+func renderSVG(art Art, opts *Options) ([]byte, error) {
+	foreground, err := parseHexColor(opts.SVGForeground)
+
+	if err != nil {
+		return nil, fmt.Errorf("--svg-foreground: %w", err)
+	}
+
+	rows := len(art.Cells)
+	columns := artColumns(art)
+
+	width := float64(columns) * svgCellWidth
+	height := float64(rows) * svgCellHeight
+	result := &bytes.Buffer{}
+
+	result.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(result, "<svg xmlns=\"http://www.w3.org/2000/svg\" viewBox=\"0 0 %g %g\" width=\"%g\" height=\"%g\">\n", width, height, width, height)
+
+	if len(opts.SVGBackground) > 0 {
+		background, err := parseHexColor(opts.SVGBackground)
+
+		if err != nil {
+			return nil, fmt.Errorf("--svg-background: %w", err)
+		}
+
+		fmt.Fprintf(result, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", hexColor(background))
+	}
+
+	colored := colorEnabled(opts)
+
+	if colored {
+		writeSVGBackgrounds(result, art, opts)
+	}
+
+	fmt.Fprintf(result, "<g font-family=\"monospace\" font-size=\"%g\" fill=\"%s\" xml:space=\"preserve\">\n", svgFontSize, hexColor(foreground))
+
+	for y, row := range art.Cells {
+		fmt.Fprintf(result, "<text x=\"0\" y=\"%g\" textLength=\"%g\" lengthAdjust=\"spacingAndGlyphs\">", float64(y)*svgCellHeight+svgFontSize*0.8, float64(rowColumns(row))*svgCellWidth)
+
+		if !colored {
+			runes := make([]rune, len(row))
+
+			for x, cell := range row {
+				runes[x] = cell.Char
+			}
+
+			result.WriteString(escapeXML(string(runes)))
+		} else {
+			for x := 0; x < len(row); {
+				c := displayColor(row[x], opts)
+				run := []rune{row[x].Char}
+
+				for x++; x < len(row) && displayColor(row[x], opts) == c; x++ {
+					run = append(run, row[x].Char)
+				}
+
+				fmt.Fprintf(result, "<tspan fill=\"%s\">%s</tspan>", hexColor(c), escapeXML(string(run)))
+			}
+		}
+
+		result.WriteString("</text>\n")
+	}
+
+	result.WriteString("</g>\n</svg>\n")
+
+	return result.Bytes(), nil
+}
@@ -0,0 +1,10 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+
+package main
+
+import "os"
+
+// terminalSize cannot query the terminal on this platform.
+func terminalSize(f *os.File) (int, int, bool) {
+	return 0, 0, false
+}
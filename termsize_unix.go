@@ -0,0 +1,21 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalSize returns the number of columns and rows of the terminal f is
+// attached to.
+func terminalSize(f *os.File) (int, int, bool) {
+	size, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+
+	if err != nil || size.Col < 1 || size.Row < 1 {
+		return 0, 0, false
+	}
+
+	return int(size.Col), int(size.Row), true
+}
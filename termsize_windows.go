@@ -0,0 +1,24 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// terminalSize returns the number of columns and rows of the console window
+// f is attached to.
+func terminalSize(f *os.File) (int, int, bool) {
+	var info windows.ConsoleScreenBufferInfo
+
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(f.Fd()), &info); err != nil {
+		return 0, 0, false
+	}
+
+	columns := int(info.Window.Right-info.Window.Left) + 1
+	rows := int(info.Window.Bottom-info.Window.Top) + 1
+
+	return columns, rows, columns > 0 && rows > 0
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+func tiffByteOrder(data []byte) (binary.ByteOrder, error) {
+	if len(data) < 8 {
+		return nil, errors.New("truncated tiff header")
+	}
+
+	switch string(data[0:4]) {
+	case "II*\x00":
+		return binary.LittleEndian, nil
+	case "MM\x00*":
+		return binary.BigEndian, nil
+	}
+
+	return nil, errors.New("invalid tiff header")
+}
+
+func tiffPageOffsets(data []byte) ([]uint32, error) {
+	order, err := tiffByteOrder(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make([]uint32, 0)
+	seen := make(map[uint32]bool)
+	offset := order.Uint32(data[4:])
+
+	for offset != 0 {
+		if seen[offset] {
+			return nil, errors.New("tiff directories form a loop")
+		}
+
+		if int(offset)+2 > len(data) {
+			return nil, fmt.Errorf("tiff directory at offset %d is out of bounds", offset)
+		}
+
+		entries := int(order.Uint16(data[offset:]))
+		next := int(offset) + 2 + entries*12
+
+		if next+4 > len(data) {
+			return nil, fmt.Errorf("tiff directory at offset %d is truncated", offset)
+		}
+
+		seen[offset] = true
+		offsets = append(offsets, offset)
+		offset = order.Uint32(data[next:])
+	}
+
+	return offsets, nil
+}
+
+func selectTIFFPage(data []byte, offsets []uint32, page int) []byte {
+	if page == 1 {
+		return data
+	}
+
+	order, _ := tiffByteOrder(data)
+	result := make([]byte, len(data))
+
+	copy(result, data)
+	order.PutUint32(result[4:], offsets[page-1])
+
+	return result
+}
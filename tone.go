@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// toneLevels is a parsed --levels value: the tones that become black and
+// white, and the gamma of the tones between them.
+type toneLevels struct {
+	Low, High, Gamma float64
+}
+
+// parseLevels reads --levels LOW,HIGH or LOW,HIGH,GAMMA. The points are 0 to
+// 1, or 0 to 255 when either is above 1.
+func parseLevels(value string) (toneLevels, error) {
+	parts := strings.Split(value, ",")
+
+	if len(parts) < 2 || len(parts) > 3 {
+		return toneLevels{}, fmt.Errorf("invalid --levels: %s: give LOW,HIGH or LOW,HIGH,GAMMA", value)
+	}
+
+	numbers := []float64{0, 0, 1}
+
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return toneLevels{}, fmt.Errorf("invalid --levels: %s: %q is not a number", value, part)
+		}
+
+		numbers[i] = number
+	}
+
+	levels := toneLevels{Low: numbers[0], High: numbers[1], Gamma: numbers[2]}
+
+	if levels.Low > 1 || levels.High > 1 {
+		levels.Low, levels.High = levels.Low/255, levels.High/255
+	}
+
+	if levels.Low < 0 || levels.High > 1 {
+		return toneLevels{}, fmt.Errorf("invalid --levels: %s: the points must be 0 to 1 or 0 to 255", value)
+	}
+
+	if levels.Low >= levels.High {
+		return toneLevels{}, fmt.Errorf("invalid --levels: %s: the black point must be below the white point", value)
+	}
+
+	if levels.Gamma <= 0 {
+		return toneLevels{}, fmt.Errorf("invalid --levels: %s: the gamma must be above 0", value)
+	}
+
+	return levels, nil
+}
+
+// checkTone validates the options that adjust the tones of the image.
+func checkTone(opts *Options) error {
+	if len(opts.Levels) > 0 {
+		levels, err := parseLevels(opts.Levels)
+
+		if err != nil {
+			return err
+		}
+
+		opts.LevelsRange = &levels
+	}
+
+	if !(opts.Gamma > 0) || math.IsInf(opts.Gamma, 0) {
+		return fmt.Errorf("--gamma must be a number above 0, got %g", opts.Gamma)
+	}
+
+	if opts.Equalize && opts.AutoContrast {
+		return fmt.Errorf("--equalize cannot be combined with --auto-contrast")
+	}
+
+	if opts.CLAHE {
+		if opts.Equalize || opts.AutoContrast {
+			return fmt.Errorf("--clahe cannot be combined with --equalize or --auto-contrast")
+		}
+
+		grid, err := parseCLAHETiles(opts.CLAHETiles)
+
+		if err != nil {
+			return err
+		}
+
+		if !(opts.CLAHEClip >= 1) {
+			return fmt.Errorf("--clahe-clip must be at least 1, got %g", opts.CLAHEClip)
+		}
+
+		opts.CLAHEGrid = grid
+	}
+
+	if !(opts.AutoContrastLow >= 0 && opts.AutoContrastLow < opts.AutoContrastHigh && opts.AutoContrastHigh <= 100) {
+		return fmt.Errorf("--auto-contrast-low and --auto-contrast-high must be percentiles with 0 <= low < high <= 100, got %g and %g", opts.AutoContrastLow, opts.AutoContrastHigh)
+	}
+
+	if !(opts.Brightness >= -1 && opts.Brightness <= 1) {
+		return fmt.Errorf("--brightness must be between -1 and 1, got %g", opts.Brightness)
+	}
+
+	if !(opts.Contrast >= 0) || math.IsInf(opts.Contrast, 0) {
+		return fmt.Errorf("--contrast must be a number of at least 0, got %g", opts.Contrast)
+	}
+
+	return nil
+}
+
+// lumHistogram counts the pixels of the image in 256 bins of luminance.
+func lumHistogram(img image.Image, formula lumaFormula) ([256]int, int) {
+	bounds := img.Bounds()
+	histogram := [256]int{}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			histogram[int(math.Round(luminance(img.At(x, y), formula)*255))]++
+		}
+	}
+
+	return histogram, bounds.Dx() * bounds.Dy()
+}
+
+// equalize spreads the luminance of the image evenly over the full range
+// through the cumulative histogram, scaling the color channels of every pixel
+// by the same factor to keep its hue.
+func equalize(img image.Image, formula lumaFormula) image.Image {
+	histogram, total := lumHistogram(img, formula)
+	mapping := [256]float64{}
+	count, lowest := 0, -1
+
+	for bin, pixels := range histogram {
+		count += pixels
+
+		if lowest < 0 && pixels > 0 {
+			lowest = count
+		}
+
+		if total > lowest {
+			mapping[bin] = float64(count-lowest) / float64(total-lowest)
+		} else {
+			mapping[bin] = float64(bin) / 255
+		}
+	}
+
+	return remapLuminance(img, formula, func(x, y int, lum float64) float64 {
+		return mapping[int(math.Round(lum*255))]
+	})
+}
+
+// remapLuminance gives every pixel the luminance the mapping returns for it,
+// scaling its color channels to keep the hue. Black pixels become gray, and
+// colors that would be scaled past white are mixed with the gray of their
+// new luminance instead, so brighter pixels never end up darker.
+func remapLuminance(img image.Image, formula lumaFormula, mapping func(x, y int, lum float64) float64) image.Image {
+	bounds := img.Bounds()
+	output := image.NewNRGBA64(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := color.NRGBA64Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA64)
+			lum := luminance(color.NRGBA64{c.R, c.G, c.B, math.MaxUint16}, formula)
+			target := mapping(x, y, lum)
+			channels := [3]float64{target, target, target}
+
+			if lum > 0 {
+				for i, v := range [3]uint16{c.R, c.G, c.B} {
+					channels[i] = float64(v) / math.MaxUint16 * target / lum
+				}
+			}
+
+			if high := math.Max(channels[0], math.Max(channels[1], channels[2])); high > 1 {
+				mix := (high - 1) / (high - target)
+
+				for i := range channels {
+					channels[i] += (target - channels[i]) * mix
+				}
+			}
+
+			channel := func(v float64) uint16 { return uint16(math.Round(math.Max(0, math.Min(1, v)) * math.MaxUint16)) }
+
+			output.SetNRGBA64(x, y, color.NRGBA64{channel(channels[0]), channel(channels[1]), channel(channels[2]), c.A})
+		}
+	}
+
+	return output
+}
+
+// autoContrast finds the luminance at the --auto-contrast-low and
+// --auto-contrast-high percentiles of the image. It reports false for an
+// image too flat to stretch.
+func autoContrast(img image.Image, opts *Options) (float64, float64, bool) {
+	histogram, total := lumHistogram(img, opts.LumaFormula)
+	low, high, count := -1, -1, 0
+
+	for bin, pixels := range histogram {
+		count += pixels
+
+		if low < 0 && float64(count) > float64(total)*opts.AutoContrastLow/100 {
+			low = bin
+		}
+
+		if high < 0 && float64(count) >= float64(total)*opts.AutoContrastHigh/100 {
+			high = bin
+		}
+	}
+
+	return float64(low) / 255, float64(high) / 255, high > low
+}
+
+// toneCurve returns the curve the tone options apply to the luminance of the
+// image, or nil when they leave it as it is. The steps run in the order auto
+// contrast, levels, gamma, contrast, brightness, each clamped to 0–1.
+// --negative inverts the channels themselves afterwards, see applyTone.
+func toneCurve(img image.Image, opts *Options) func(v float64) float64 {
+	steps := make([]func(v float64) float64, 0)
+
+	if opts.AutoContrast {
+		low, high, ok := autoContrast(img, opts)
+
+		if ok {
+			steps = append(steps, func(v float64) float64 { return (v - low) / (high - low) })
+		}
+
+		if opts.Verbose && ok {
+			fmt.Printf("VERBOSE: Auto contrast stretched luminance %.3f to %.3f over the full range\n", low, high)
+		} else if opts.Verbose {
+			fmt.Printf("VERBOSE: Auto contrast left the image alone, its pixels are all about as bright\n")
+		}
+	}
+
+	if levels := opts.LevelsRange; levels != nil {
+		exponent := 1 / levels.Gamma
+
+		steps = append(steps, func(v float64) float64 {
+			return math.Pow(math.Max(0, math.Min(1, (v-levels.Low)/(levels.High-levels.Low))), exponent)
+		})
+	}
+
+	if opts.Gamma != 1 {
+		// Above 1 brightens the shadows and midtones, below 1 darkens them.
+		exponent := 1 / opts.Gamma
+
+		steps = append(steps, func(v float64) float64 { return math.Pow(v, exponent) })
+	}
+
+	if opts.Contrast != 1 {
+		steps = append(steps, func(v float64) float64 { return (v-0.5)*opts.Contrast + 0.5 })
+	}
+
+	if opts.Brightness != 0 {
+		steps = append(steps, func(v float64) float64 { return v + opts.Brightness })
+	}
+
+	if len(steps) < 1 {
+		return nil
+	}
+
+	return func(v float64) float64 {
+		for _, step := range steps {
+			v = math.Max(0, math.Min(1, step(v)))
+		}
+
+		return v
+	}
+}
+
+// applyTone maps every color channel of the image through the curve, leaving
+// alpha alone. Unlike remapLuminance it changes the hue and saturation, as
+// --negative means to.
+func applyTone(img image.Image, curve func(v float64) float64) image.Image {
+	table := make([]uint16, 1<<16)
+
+	for i := range table {
+		table[i] = uint16(math.Round(curve(float64(i)/math.MaxUint16) * math.MaxUint16))
+	}
+
+	bounds := img.Bounds()
+	output := image.NewNRGBA64(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := color.NRGBA64Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA64)
+
+			output.SetNRGBA64(x, y, color.NRGBA64{table[c.R], table[c.G], table[c.B], c.A})
+		}
+	}
+
+	return output
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNegative(t *testing.T) {
+	// Black on the left, white on the right.
+	img := grayImage(4, 1, func(x, y int) uint8 { return uint8(x / 2 * 255) })
+	black, white := color.NRGBA{0, 0, 0, 255}, color.NRGBA{255, 255, 255, 255}
+
+	for _, test := range []struct {
+		name  string
+		args  []string
+		want  string
+		left  color.NRGBA
+		right color.NRGBA
+	}{
+		{"plain", nil, "  ##", black, white},
+		{"negative", []string{"--negative"}, "##  ", white, black},
+		{"invert-charset", []string{"--invert-charset"}, "##  ", black, white},
+		// The two cancel out for the characters, not for the colors.
+		{"both", []string{"--negative", "--invert-charset"}, "  ##", white, black},
+		{"negative dithered", []string{"--negative", "--dither", "floyd-steinberg"}, "##  ", white, black},
+		{"negative ordered", []string{"--negative", "--dither", "ordered"}, "##  ", white, black},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			art := convertImage(t, img, append([]string{"-r", "4x1", "--charset-string", " #", "--color", "truecolor"}, test.args...)...)
+
+			if rows := artRows(art); !reflect.DeepEqual(rows, []string{test.want}) {
+				t.Errorf("rows = %q, want %q", rows, []string{test.want})
+			}
+
+			if left, right := art.Cells[0][0].Color, art.Cells[0][3].Color; left != test.left || right != test.right {
+				t.Errorf("colors = %v and %v, want %v and %v", left, right, test.left, test.right)
+			}
+		})
+	}
+}
+
+// hueGradient returns an image one pixel tall of colors of changing hue,
+// ordered by their luminance.
+func hueGradient() *image.NRGBA {
+	colors := make([]color.NRGBA, 0, 60)
+
+	for i := 0; i < 60; i++ {
+		colors = append(colors, fromHSL(float64(i*47%360), 0.8, 0.1+float64(i)*0.013, 255))
+	}
+
+	sort.Slice(colors, func(i, j int) bool { return luminance(colors[i], nil) < luminance(colors[j], nil) })
+
+	img := image.NewNRGBA(image.Rect(0, 0, len(colors), 1))
+
+	for x, c := range colors {
+		img.SetNRGBA(x, 0, c)
+	}
+
+	return img
+}
+
+func TestToneCurveFollowsLuminance(t *testing.T) {
+	img := hueGradient()
+
+	for _, args := range [][]string{
+		{"--gamma", "2.2"},
+		{"--gamma", "0.45"},
+		{"--levels", "0.1,0.9,1.5"},
+		{"--levels", "0.2,0.8,0.6", "--contrast", "1.5"},
+	} {
+		t.Run(fmt.Sprint(args), func(t *testing.T) {
+			art := convertImage(t, img, append([]string{"-r", "60x1", "--color", "truecolor"}, args...)...)
+			previous := -1.0
+
+			for x, cell := range art.Cells[0] {
+				if cell.Lum < previous-1e-3 {
+					t.Errorf("luminance falls from %.4f to %.4f at %d, so the characters no longer follow the brightness", previous, cell.Lum, x)
+				}
+
+				previous = cell.Lum
+			}
+		})
+	}
+}
+
+func TestGammaKeepsHue(t *testing.T) {
+	// Darkening never pushes a channel past white, so the luminance is
+	// exactly the curve of the original and every hue stays.
+	img := hueGradient()
+	art := convertImage(t, img, "-r", "60x1", "--color", "truecolor", "--gamma", "0.5")
+
+	for x, cell := range art.Cells[0] {
+		original := img.NRGBAAt(x, 0)
+		lum := luminance(original, nil)
+
+		if math.Abs(cell.Lum-lum*lum) > 0.01 {
+			t.Errorf("luminance of %v is %.4f, want %.4f", original, cell.Lum, lum*lum)
+		}
+
+		if h, _, _ := toHSL(original); cell.Lum > 0.05 {
+			if got, _, _ := toHSL(cell.Color); math.Abs(math.Mod(got-h+540, 360)-180) > 6 {
+				t.Errorf("hue of %v turned from %.0f to %.0f", original, h, got)
+			}
+		}
+	}
+}
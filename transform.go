@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func remap(img image.Image, width, height int, source func(x, y int) (int, int)) image.Image {
+	bounds := img.Bounds()
+	output := image.NewRGBA64(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sx, sy := source(x, y)
+
+			output.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+
+	return output
+}
+
+func rotate90(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	return remap(img, h, w, func(x, y int) (int, int) { return y, h - 1 - x })
+}
+
+func rotate180(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y })
+}
+
+func rotate270(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	return remap(img, h, w, func(x, y int) (int, int) { return w - 1 - y, x })
+}
+
+func flipHorizontal(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, y })
+}
+
+func flipVertical(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	return remap(img, w, h, func(x, y int) (int, int) { return x, h - 1 - y })
+}
+
+func transpose(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	return remap(img, h, w, func(x, y int) (int, int) { return y, x })
+}
+
+func transverse(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	return remap(img, h, w, func(x, y int) (int, int) { return w - 1 - y, h - 1 - x })
+}
+
+// orient applies the transformation described by an EXIF Orientation value
+// so that the image is displayed upright.
+func orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return flipHorizontal(img)
+	case 3:
+		return rotate180(img)
+	case 4:
+		return flipVertical(img)
+	case 5:
+		return transpose(img)
+	case 6:
+		return rotate90(img)
+	case 7:
+		return transverse(img)
+	case 8:
+		return rotate270(img)
+	}
+
+	return img
+}
+
+var cropPattern = regexp.MustCompile(`^(\d+)x(\d+)(?:([+-]\d+)([+-]\d+))?$`)
+
+// parseCrop reads a --crop geometry of WxH+X+Y for an image of the given
+// size. Negative offsets count from the right and bottom edges, as in
+// ImageMagick. Rectangles reaching past the image are clamped to it when
+// clamp is set and are an error otherwise.
+func parseCrop(value string, size image.Point, clamp bool) (image.Rectangle, error) {
+	match := cropPattern.FindStringSubmatch(value)
+
+	if match == nil {
+		return image.Rectangle{}, fmt.Errorf("invalid --crop geometry: %s (expected WxH+X+Y)", value)
+	}
+
+	numbers := make([]int, 4)
+
+	for i, part := range match[1:] {
+		if len(part) < 1 {
+			continue
+		}
+
+		number, err := strconv.Atoi(part)
+
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("invalid --crop geometry: %s", value)
+		}
+
+		numbers[i] = number
+	}
+
+	width, height, x, y := numbers[0], numbers[1], numbers[2], numbers[3]
+
+	if width < 1 || height < 1 {
+		return image.Rectangle{}, fmt.Errorf("invalid --crop geometry: %s: the size must be at least 1x1", value)
+	}
+
+	if strings.HasPrefix(match[3], "-") {
+		x = size.X - width + x
+	}
+
+	if strings.HasPrefix(match[4], "-") {
+		y = size.Y - height + y
+	}
+
+	rect := image.Rect(x, y, x+width, y+height)
+
+	if rect.In(image.Rect(0, 0, size.X, size.Y)) {
+		return rect, nil
+	}
+
+	if !clamp {
+		return image.Rectangle{}, fmt.Errorf("--crop %s reaches outside the %dx%d image (pass --crop-clamp to clamp it)", value, size.X, size.Y)
+	}
+
+	rect = rect.Intersect(image.Rect(0, 0, size.X, size.Y))
+
+	if rect.Empty() {
+		return image.Rectangle{}, fmt.Errorf("--crop %s lies outside the %dx%d image", value, size.X, size.Y)
+	}
+
+	return rect, nil
+}
+
+func crop(img image.Image, rect image.Rectangle) image.Image {
+	return remap(img, rect.Dx(), rect.Dy(), func(x, y int) (int, int) { return rect.Min.X + x, rect.Min.Y + y })
+}
+
+// transformFrames applies the geometry options to every decoded frame, after
+// the EXIF orientation and before resizing: --rotate first, then --flip,
+// --crop and --trim-border.
+func transformFrames(frames []Frame, opts *Options) error {
+	for i := range frames {
+		switch opts.Rotate {
+		case "90":
+			frames[i].Image = rotate90(frames[i].Image)
+		case "180":
+			frames[i].Image = rotate180(frames[i].Image)
+		case "270":
+			frames[i].Image = rotate270(frames[i].Image)
+		}
+
+		switch opts.Flip {
+		case "h":
+			frames[i].Image = flipHorizontal(frames[i].Image)
+		case "v":
+			frames[i].Image = flipVertical(frames[i].Image)
+		}
+
+		if len(opts.Crop) > 0 {
+			size := frames[i].Image.Bounds().Size()
+			rect, err := parseCrop(opts.Crop, size, opts.CropClamp)
+
+			if err != nil {
+				return err
+			}
+
+			if opts.Verbose && i == 0 {
+				fmt.Printf("VERBOSE: Cropped image from %s to %dx%d at %d,%d\n", size, rect.Dx(), rect.Dy(), rect.Min.X, rect.Min.Y)
+			}
+
+			frames[i].Image = crop(frames[i].Image, rect)
+		}
+
+		if opts.TrimBorder {
+			frames[i].Image = trimBorder(frames[i].Image, opts, i == 0)
+		}
+	}
+
+	return nil
+}
+
+// similarColor reports whether no channel of a and b differs by more than
+// tolerance, given from 0 to 1.
+func similarColor(a, b color.NRGBA, tolerance float64) bool {
+	limit := tolerance * 255
+
+	for _, pair := range [][2]uint8{{a.R, b.R}, {a.G, b.G}, {a.B, b.B}, {a.A, b.A}} {
+		if math.Abs(float64(pair[0])-float64(pair[1])) > limit {
+			return false
+		}
+	}
+
+	return true
+}
+
+// trimBorder crops away the rows and columns at the edges that are all within
+// --trim-tolerance of the top left corner's color. Uniform images are left
+// alone rather than trimmed to nothing.
+func trimBorder(img image.Image, opts *Options, report bool) image.Image {
+	bounds := img.Bounds()
+	at := func(x, y int) color.NRGBA {
+		return color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+	}
+
+	size := bounds.Size()
+	corner := at(0, 0)
+	uniformRow := func(y, fromX, toX int) bool {
+		for x := fromX; x < toX; x++ {
+			if !similarColor(at(x, y), corner, opts.TrimTolerance) {
+				return false
+			}
+		}
+
+		return true
+	}
+	uniformColumn := func(x, fromY, toY int) bool {
+		for y := fromY; y < toY; y++ {
+			if !similarColor(at(x, y), corner, opts.TrimTolerance) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	top, bottom := 0, size.Y
+
+	for top < bottom && uniformRow(top, 0, size.X) {
+		top++
+	}
+
+	if top == bottom {
+		if report {
+			fmt.Fprintf(os.Stderr, "asciify: warning: --trim-border: the image is a single color, so nothing was trimmed\n")
+		}
+
+		return img
+	}
+
+	for uniformRow(bottom-1, 0, size.X) {
+		bottom--
+	}
+
+	left, right := 0, size.X
+
+	for uniformColumn(left, top, bottom) {
+		left++
+	}
+
+	for uniformColumn(right-1, top, bottom) {
+		right--
+	}
+
+	if opts.Verbose && report {
+		fmt.Printf("VERBOSE: Trimmed the border by %d pixels at the top, %d at the right, %d at the bottom and %d at the left\n", top, size.X-right, size.Y-bottom, left)
+	}
+
+	return crop(img, image.Rect(left, top, right, bottom))
+}
+
+// cropToAspect crops the image to the given width to height ratio, keeping
+// the part --gravity points at.
+func cropToAspect(img image.Image, aspect float64, gravity string) image.Image {
+	size := img.Bounds().Size()
+	width, height := size.X, size.Y
+
+	if float64(width)/float64(height) > aspect {
+		width = int(math.Max(1, math.Round(float64(height)*aspect)))
+	} else {
+		height = int(math.Max(1, math.Round(float64(width)/aspect)))
+	}
+
+	offset := gravityOffsets[gravity]
+	x := int(float64(size.X-width) * offset[0])
+	y := int(float64(size.Y-height) * offset[1])
+
+	return crop(img, image.Rect(x, y, x+width, y+height))
+}
+
+// composite draws the image over the --background color, so transparent
+// pixels take its tone rather than whatever their color channels hold. The
+// result keeps 16 bits per channel for 16-bit inputs.
+func composite(img image.Image, background color.NRGBA) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	output := image.NewRGBA64(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	draw.Draw(output, output.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(output, output.Bounds(), img, bounds.Min, draw.Over)
+
+	return output
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestRotateFlip(t *testing.T) {
+	// Every pixel of the fixture maps to its own digit, so any mirroring or
+	// turn shows in the rows:
+	//	012
+	//	345
+	img := grayImage(3, 2, func(x, y int) uint8 { return uint8((2*(y*3+x) + 1) * 255 / 12) })
+
+	for _, test := range []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"012", "345"}},
+		{[]string{"--rotate", "90"}, []string{"30", "41", "52"}},
+		{[]string{"--rotate", "180"}, []string{"543", "210"}},
+		{[]string{"--rotate", "270"}, []string{"25", "14", "03"}},
+		{[]string{"--flip", "h"}, []string{"210", "543"}},
+		{[]string{"--flip", "v"}, []string{"345", "012"}},
+		// The rotation comes first: turned, then mirrored.
+		{[]string{"--rotate", "90", "--flip", "h"}, []string{"03", "14", "25"}},
+		{[]string{"--rotate", "90", "--flip", "v"}, []string{"52", "41", "30"}},
+		{[]string{"--rotate", "270", "--flip", "h"}, []string{"52", "41", "30"}},
+	} {
+		t.Run(fmt.Sprint(test.args), func(t *testing.T) {
+			art := convertImage(t, img, append([]string{"--charset-string", "012345"}, test.args...)...)
+
+			if rows := artRows(art); !reflect.DeepEqual(rows, test.want) {
+				t.Errorf("rows = %q, want %q", rows, test.want)
+			}
+		})
+	}
+}
+
+func TestRotateScale(t *testing.T) {
+	img := grayImage(40, 10, func(x, y int) uint8 { return 0 })
+
+	for _, test := range []struct {
+		rotate        string
+		width, height int
+	}{
+		{"0", 80, 10},
+		{"90", 20, 40},
+		{"180", 80, 10},
+		{"270", 20, 40},
+	} {
+		t.Run(test.rotate, func(t *testing.T) {
+			art := convertImage(t, img, "--rotate", test.rotate, "--scale", "2", "--cell-aspect", "0.5")
+
+			if width, height := artWidth(art), len(art.Cells); width != test.width || height != test.height {
+				t.Errorf("art is %dx%d, want %dx%d", width, height, test.width, test.height)
+			}
+		})
+	}
+}
+
+func TestTranslatedBounds(t *testing.T) {
+	levels := []uint8{0, 85, 170, 255}
+	ramp := Ramp{Chars: []rune(" .:#"), Width: 1}
+	want := []string{" .:#", " .:#"}
+
+	translated := image.NewRGBA(image.Rect(-7, 20, -3, 22))
+
+	// The larger fixture has the same columns in its bottom right corner,
+	// surrounded by white.
+	larger := image.NewRGBA(image.Rect(0, 0, 8, 6))
+
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			larger.Set(x, y, color.White)
+
+			if x >= 4 && y >= 4 {
+				larger.Set(x, y, color.Gray{levels[x-4]})
+			}
+		}
+	}
+
+	for y := 20; y < 22; y++ {
+		for x := -7; x < -3; x++ {
+			translated.Set(x, y, color.Gray{levels[x+7]})
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		img  image.Image
+	}{
+		{"translated", translated},
+		{"SubImage", larger.SubImage(image.Rect(4, 4, 8, 6))},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if rows := artRows(Art{Cells: convert(test.img, ramp, nil)}); !reflect.DeepEqual(rows, want) {
+				t.Errorf("convert rows = %q, want %q", rows, want)
+			}
+
+			for _, filter := range []string{"nearest", "bilinear", "bicubic", "lanczos", "area"} {
+				// Sampling outside the bounds would bring in the white
+				// around the SubImage or the black zero value.
+				result := resize(test.img, 2, 2, filter)
+
+				if size := result.Bounds().Size(); size != image.Pt(2, 2) {
+					t.Fatalf("%s: resized to %v, want 2x2", filter, size)
+				}
+
+				if lum := luminance(result.At(result.Bounds().Min.X, result.Bounds().Min.Y), nil); lum > 0.4 {
+					t.Errorf("%s: left luminance is %g, want at most 0.4", filter, lum)
+				}
+
+				if lum := luminance(result.At(result.Bounds().Max.X-1, result.Bounds().Max.Y-1), nil); lum < 0.6 {
+					t.Errorf("%s: right luminance is %g, want at least 0.6", filter, lum)
+				}
+			}
+		})
+	}
+}
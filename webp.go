@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+func webpVariant(data []byte) string {
+	if len(data) < 12 || !bytes.HasPrefix(data, []byte("RIFF")) || string(data[8:12]) != "WEBP" {
+		return ""
+	}
+
+	for offset := 12; offset+8 <= len(data); {
+		switch string(data[offset : offset+4]) {
+		case "VP8 ":
+			return "lossy"
+		case "VP8L":
+			return "lossless"
+		}
+
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		offset += 8 + size + size%2
+	}
+
+	return ""
+}
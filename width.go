@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// runeWidth measures characters as terminals do by default. East Asian
+// ambiguous characters such as the shades and blocks are narrow whatever the
+// locale says, which would otherwise make the built-in ramps mix widths.
+var runeWidth = &runewidth.Condition{EastAsianWidth: false, StrictEmojiNeutral: true}
+
+// runeColumns returns the number of terminal columns a character takes,
+// treating zero width characters as one column so they cannot collapse a
+// cell.
+func runeColumns(char rune) int {
+	if width := runeWidth.RuneWidth(char); width > 1 {
+		return width
+	}
+
+	return 1
+}
+
+// rampWidth returns the number of columns every character of a ramp takes.
+// Ramps mixing narrow and wide characters are rejected, as their rows would
+// not line up.
+func rampWidth(chars []rune) (int, error) {
+	width := 0
+
+	for _, char := range chars {
+		columns := runeWidth.RuneWidth(char)
+
+		if columns < 1 {
+			return 0, fmt.Errorf("%q takes no columns of its own", char)
+		}
+
+		if width > 0 && columns != width {
+			return 0, fmt.Errorf("mixes narrow and wide characters such as %q and %q, so the rows would not line up", chars[0], char)
+		}
+
+		width = columns
+	}
+
+	return width, nil
+}
+
+func rowColumns(row []Cell) int {
+	columns := 0
+
+	for _, cell := range row {
+		columns += runeColumns(cell.Char)
+	}
+
+	return columns
+}
+
+// artColumns returns the width of the art in terminal columns, which is more
+// than its number of cells when it contains wide characters.
+func artColumns(art Art) int {
+	width := 0
+
+	for _, row := range art.Cells {
+		if columns := rowColumns(row); columns > width {
+			width = columns
+		}
+	}
+
+	return width
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattn/go-runewidth"
+)
+
+func TestWideRamp(t *testing.T) {
+	levels := []uint8{0, 80, 160, 255}
+	img := grayImage(len(levels), 1, func(x, y int) uint8 { return levels[x] })
+
+	for _, test := range []struct {
+		name string
+		ramp string
+	}{
+		{"full-width", "　．：＃"},
+		{"emoji", "🌑🌓🌔🌕"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if width, err := rampWidth([]rune(test.ramp)); err != nil || width != 2 {
+				t.Fatalf("rampWidth = %d, %v, want 2", width, err)
+			}
+
+			// The 8 columns asked for fit 4 wide characters.
+			args := []string{"-r", "8x1", "--charset-string", test.ramp}
+			art := convertImage(t, img, args...)
+
+			if rows := artRows(art); !reflect.DeepEqual(rows, []string{test.ramp}) {
+				t.Fatalf("rows = %q, want %q", rows, []string{test.ramp})
+			}
+
+			if columns := artColumns(art); columns != 8 {
+				t.Errorf("artColumns = %d, want 8", columns)
+			}
+
+			opts := testOptions(t, args...)
+			document, err := renderHTML(art, opts)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if count := strings.Count(string(document), "<span class=\"w\">"); count != 4 {
+				t.Errorf("HTML wraps %d characters as wide, want 4", count)
+			}
+
+			raster, err := rasterize(art, opts)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if width := raster.Bounds().Dx(); width != 8*rasterFace.Advance {
+				t.Errorf("PNG is %d pixels wide, want %d", width, 8*rasterFace.Advance)
+			}
+		})
+	}
+}
+
+func TestMixedWidthRamp(t *testing.T) {
+	if _, err := rampWidth([]rune(" .＃🌕")); err == nil {
+		t.Error("rampWidth accepted a ramp mixing narrow and wide characters")
+	}
+}
+
+func TestRampWidthEastAsianLocale(t *testing.T) {
+	// The package default follows the locale, which counts ambiguous
+	// characters such as the shades as wide in East Asian ones.
+	previous := runewidth.DefaultCondition.EastAsianWidth
+	runewidth.DefaultCondition.EastAsianWidth = true
+
+	defer func() { runewidth.DefaultCondition.EastAsianWidth = previous }()
+
+	if runewidth.RuneWidth('█') != 2 {
+		t.Fatal("the locale condition does not count █ as wide")
+	}
+
+	for _, name := range []string{"blocks", "binary"} {
+		ramp, err := resolveCharset(testOptions(t, "-c", name))
+
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if ramp.Width != 1 {
+			t.Errorf("%s is %d columns wide, want 1", name, ramp.Width)
+		}
+	}
+}